@@ -0,0 +1,389 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"mime"
+	"net/http"
+	"net/url"
+	"os"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	// alertMaxEntries caps the entries sent with one alert.
+	alertMaxEntries = 20
+	alertHistoryMax = 200
+	alertTimeout    = 10 * time.Second
+)
+
+// alertRuleSpec is how a rule is written in --alerts files and sent to the
+// API. Durations use Go syntax such as "30s" or "5m". A rule posts to
+// Webhook, runs Command, or both.
+type alertRuleSpec struct {
+	Name        string   `json:"name"`
+	Filter      string   `json:"filter"`
+	Threshold   int      `json:"threshold,omitempty"`
+	Window      string   `json:"window,omitempty"`
+	Cooldown    string   `json:"cooldown,omitempty"`
+	Webhook     string   `json:"webhook,omitempty"`
+	Command     []string `json:"command,omitempty"`
+	Timeout     string   `json:"timeout,omitempty"`
+	Concurrency int      `json:"concurrency,omitempty"`
+	Rate        string   `json:"rate,omitempty"`
+}
+
+// alertRule fires once Threshold entries matching Filter arrive within
+// Window, then stays quiet for Cooldown.
+type alertRule struct {
+	spec      alertRuleSpec
+	filters   []filterExpression
+	threshold int
+	window    time.Duration
+	cooldown  time.Duration
+	command   *commandAction
+
+	matches   []alertMatch
+	lastFired time.Time
+}
+
+type alertMatch struct {
+	at    time.Time
+	entry LogEntry
+}
+
+// alertFiring records one webhook call or command run for /alerts. It is
+// added to the history when the webhook has answered or the command exited.
+type alertFiring struct {
+	Rule     string    `json:"rule"`
+	Action   string    `json:"action"`
+	FiredAt  time.Time `json:"firedAt"`
+	Count    int       `json:"count"`
+	Status   int       `json:"status,omitempty"`
+	ExitCode *int      `json:"exitCode,omitempty"`
+	Error    string    `json:"error,omitempty"`
+}
+
+// alertPayload is the JSON body posted to a rule's webhook.
+type alertPayload struct {
+	Rule      string     `json:"rule"`
+	Filter    string     `json:"filter"`
+	Threshold int        `json:"threshold"`
+	Window    string     `json:"window,omitempty"`
+	Count     int        `json:"count"`
+	FiredAt   time.Time  `json:"firedAt"`
+	Entries   []LogEntry `json:"entries"`
+}
+
+func newAlertRule(spec alertRuleSpec) (*alertRule, error) {
+	spec.Name = strings.TrimSpace(spec.Name)
+	if spec.Name == "" {
+		return nil, errors.New("rule needs a name")
+	}
+	if strings.TrimSpace(spec.Filter) == "" {
+		return nil, fmt.Errorf("rule %s: needs a filter", spec.Name)
+	}
+	filters, err := parseFilterExpressions([]string{spec.Filter})
+	if err != nil {
+		return nil, fmt.Errorf("rule %s: %w", spec.Name, err)
+	}
+	if spec.Webhook == "" && len(spec.Command) == 0 {
+		return nil, fmt.Errorf("rule %s: needs a webhook or a command", spec.Name)
+	}
+	if spec.Webhook != "" {
+		if u, err := url.Parse(spec.Webhook); err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+			return nil, fmt.Errorf("rule %s: webhook must be an http(s) URL", spec.Name)
+		}
+	}
+	rule := &alertRule{spec: spec, filters: filters, threshold: spec.Threshold}
+	if len(spec.Command) > 0 {
+		if strings.TrimSpace(spec.Command[0]) == "" {
+			return nil, fmt.Errorf("rule %s: command needs a program", spec.Name)
+		}
+		if rule.command, err = newCommandAction(spec); err != nil {
+			return nil, fmt.Errorf("rule %s: %w", spec.Name, err)
+		}
+	}
+	if rule.threshold < 1 {
+		rule.threshold = 1
+	}
+	for _, field := range []struct {
+		name  string
+		value string
+		dest  *time.Duration
+	}{{"window", spec.Window, &rule.window}, {"cooldown", spec.Cooldown, &rule.cooldown}} {
+		if field.value == "" {
+			continue
+		}
+		if *field.dest, err = time.ParseDuration(field.value); err != nil || *field.dest < 0 {
+			return nil, fmt.Errorf("rule %s: invalid %s %q", spec.Name, field.name, field.value)
+		}
+	}
+	if rule.threshold > 1 && rule.window == 0 {
+		return nil, fmt.Errorf("rule %s: a threshold needs a window", spec.Name)
+	}
+	return rule, nil
+}
+
+// alertManager checks every stored entry against the alert rules. Rules can
+// be replaced at runtime through the API. Command output is ingested into
+// pipeline.
+type alertManager struct {
+	mu       sync.Mutex
+	rules    []*alertRule
+	history  []alertFiring
+	client   *http.Client
+	pipeline *Pipeline
+}
+
+func newAlertManager(pipeline *Pipeline) *alertManager {
+	return &alertManager{client: &http.Client{Timeout: alertTimeout}, pipeline: pipeline}
+}
+
+// loadAlertRules reads a JSON array of rules.
+func loadAlertRules(path string) ([]alertRuleSpec, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	var specs []alertRuleSpec
+	if err := json.Unmarshal(data, &specs); err != nil {
+		return nil, fmt.Errorf("%s: %w", path, err)
+	}
+	return specs, nil
+}
+
+// Put adds a rule, replacing any rule with the same name.
+func (m *alertManager) Put(spec alertRuleSpec) error {
+	rule, err := newAlertRule(spec)
+	if err != nil {
+		return err
+	}
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	for i, existing := range m.rules {
+		if existing.spec.Name == rule.spec.Name {
+			m.rules[i] = rule
+			return nil
+		}
+	}
+	m.rules = append(m.rules, rule)
+	return nil
+}
+
+func (m *alertManager) Delete(name string) bool {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	for i, rule := range m.rules {
+		if rule.spec.Name == name {
+			m.rules = append(m.rules[:i], m.rules[i+1:]...)
+			return true
+		}
+	}
+	return false
+}
+
+func (m *alertManager) Write(entry LogEntry) {
+	now := time.Now()
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	for _, rule := range m.rules {
+		// A rule never matches its own command's output.
+		if rule.command != nil && entry.Source == "command:"+rule.spec.Name {
+			continue
+		}
+		if !passesFilterExpressions(entry, rule.filters) {
+			continue
+		}
+		rule.matches = append(rule.matches, alertMatch{at: now, entry: entry})
+		if rule.window > 0 {
+			kept := rule.matches[:0]
+			for _, match := range rule.matches {
+				if now.Sub(match.at) <= rule.window {
+					kept = append(kept, match)
+				}
+			}
+			rule.matches = kept
+		}
+		if len(rule.matches) < rule.threshold || (!rule.lastFired.IsZero() && now.Sub(rule.lastFired) < rule.cooldown) {
+			if rule.window == 0 {
+				rule.matches = nil
+			}
+			continue
+		}
+		m.fire(rule, now)
+	}
+}
+
+// fire posts the rule's matching entries, newest last, and runs its command
+// for the newest one. Outcomes are recorded in the history once known. The
+// caller holds m.mu.
+func (m *alertManager) fire(rule *alertRule, now time.Time) {
+	matches := rule.matches
+	if len(matches) > alertMaxEntries {
+		matches = matches[len(matches)-alertMaxEntries:]
+	}
+	payload := alertPayload{
+		Rule:      rule.spec.Name,
+		Filter:    rule.spec.Filter,
+		Threshold: rule.threshold,
+		Window:    rule.spec.Window,
+		Count:     len(rule.matches),
+		FiredAt:   now,
+		Entries:   make([]LogEntry, len(matches)),
+	}
+	for i, match := range matches {
+		payload.Entries[i] = match.entry
+	}
+	rule.matches = nil
+	rule.lastFired = now
+	if webhook := rule.spec.Webhook; webhook != "" {
+		go func() {
+			firing := alertFiring{Rule: payload.Rule, Action: "webhook", FiredAt: now, Count: payload.Count}
+			firing.Status, firing.Error = m.post(webhook, payload)
+			if firing.Error != "" {
+				log.Printf("alert %s: %s", payload.Rule, firing.Error)
+			}
+			m.mu.Lock()
+			defer m.mu.Unlock()
+			m.record(firing)
+		}()
+	}
+	if action := rule.command; action != nil {
+		firing := alertFiring{Rule: payload.Rule, Action: "command", FiredAt: now, Count: payload.Count}
+		if err := action.reserve(now); err != nil {
+			firing.Error = err.Error()
+			m.record(firing)
+			return
+		}
+		entry := payload.Entries[len(payload.Entries)-1]
+		go func() {
+			code, err := runCommand(m.pipeline, payload.Rule, action, payload.Count, entry)
+			firing.ExitCode = &code
+			if err != nil {
+				firing.Error = err.Error()
+				m.pipeline.Ingest(commandFailureEntry(payload.Rule, err))
+			}
+			m.mu.Lock()
+			defer m.mu.Unlock()
+			action.running--
+			m.record(firing)
+		}()
+	}
+}
+
+// record adds a firing to the history. The caller holds m.mu.
+func (m *alertManager) record(firing alertFiring) {
+	m.history = append(m.history, firing)
+	if len(m.history) > alertHistoryMax {
+		m.history = append([]alertFiring(nil), m.history[len(m.history)-alertHistoryMax:]...)
+	}
+}
+
+func (m *alertManager) post(webhook string, payload alertPayload) (int, string) {
+	body, err := json.Marshal(payload)
+	if err != nil {
+		return 0, err.Error()
+	}
+	resp, err := m.client.Post(webhook, "application/json", bytes.NewReader(body))
+	if err != nil {
+		return 0, err.Error()
+	}
+	defer resp.Body.Close()
+	_, _ = io.Copy(io.Discard, io.LimitReader(resp.Body, 64*1024))
+	if resp.StatusCode >= 300 {
+		return resp.StatusCode, "webhook returned " + resp.Status
+	}
+	return resp.StatusCode, ""
+}
+
+func (m *alertManager) snapshot() ([]alertRuleSpec, []alertFiring) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	rules := make([]alertRuleSpec, len(m.rules))
+	for i, rule := range m.rules {
+		rules[i] = rule.spec
+	}
+	history := append([]alertFiring(nil), m.history...)
+	sort.SliceStable(history, func(i, j int) bool {
+		return history[i].FiredAt.After(history[j].FiredAt)
+	})
+	return rules, history
+}
+
+// serveAlerts lists the rules and their fire history, newest first.
+func serveAlerts(alerts *alertManager) http.HandlerFunc {
+	return func(w http.ResponseWriter, _ *http.Request) {
+		rules, history := alerts.snapshot()
+		writeJSON(w, http.StatusOK, map[string]interface{}{"rules": rules, "history": history})
+	}
+}
+
+// serveAlertRules adds or replaces a rule with POST /alerts/rules and
+// removes one with DELETE /alerts/rules/<name>. Any web page the user visits
+// can send requests to a local zlog, so changes must be JSON requests from
+// zlog's own origin, which browsers only allow after a CORS preflight that
+// zlog never grants. Rules that run commands are refused outright and can
+// only come from the --alerts file.
+func serveAlertRules(alerts *alertManager) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		name := strings.Trim(strings.TrimPrefix(r.URL.Path, "/alerts/rules"), "/")
+		if err := checkRuleRequest(r); err != nil {
+			http.Error(w, err.Error(), http.StatusForbidden)
+			return
+		}
+		switch {
+		case r.Method == http.MethodPost && name == "":
+			var spec alertRuleSpec
+			if err := json.NewDecoder(io.LimitReader(r.Body, 1<<20)).Decode(&spec); err != nil {
+				http.Error(w, err.Error(), http.StatusBadRequest)
+				return
+			}
+			if len(spec.Command) > 0 {
+				http.Error(w, "command rules can only be loaded with --alerts", http.StatusForbidden)
+				return
+			}
+			if err := alerts.Put(spec); err != nil {
+				http.Error(w, err.Error(), http.StatusBadRequest)
+				return
+			}
+			writeJSON(w, http.StatusOK, spec)
+		case r.Method == http.MethodDelete && name != "":
+			if !alerts.Delete(name) {
+				http.Error(w, "no such rule", http.StatusNotFound)
+				return
+			}
+			w.WriteHeader(http.StatusNoContent)
+		default:
+			http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		}
+	}
+}
+
+// checkRuleRequest rejects rule changes that a cross-site page could send: a
+// body that is not declared as JSON, or an Origin other than this host.
+func checkRuleRequest(r *http.Request) error {
+	if r.Method != http.MethodPost && r.Method != http.MethodDelete {
+		return nil
+	}
+	if r.Method == http.MethodPost {
+		mediaType, _, err := mime.ParseMediaType(r.Header.Get("Content-Type"))
+		if err != nil || mediaType != "application/json" {
+			return errors.New("rule changes must be sent as Content-Type: application/json")
+		}
+	}
+	if origin := r.Header.Get("Origin"); origin != "" {
+		u, err := url.Parse(origin)
+		if err != nil || !strings.EqualFold(u.Host, r.Host) {
+			return fmt.Errorf("origin %s may not change alert rules", origin)
+		}
+	}
+	return nil
+}
@@ -0,0 +1,259 @@
+package main
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// ANSI handling modes for --ansi.
+const (
+	ansiStrip = "strip"
+	ansiSpans = "spans"
+	ansiKeep  = "keep"
+)
+
+// ansiSpan is a run of message text sharing one SGR style. Named colors use
+// the terminal palette names ("red", "bright-blue") so the UI can theme them;
+// 256-color and truecolor values are sent as "#rrggbb".
+type ansiSpan struct {
+	Text      string `json:"text"`
+	FG        string `json:"fg,omitempty"`
+	BG        string `json:"bg,omitempty"`
+	Bold      bool   `json:"bold,omitempty"`
+	Dim       bool   `json:"dim,omitempty"`
+	Italic    bool   `json:"italic,omitempty"`
+	Underline bool   `json:"underline,omitempty"`
+}
+
+var ansiColorNames = []string{"black", "red", "green", "yellow", "blue", "magenta", "cyan", "white"}
+
+func parseANSIMode(raw string) (string, error) {
+	switch mode := strings.ToLower(strings.TrimSpace(raw)); mode {
+	case "":
+		return ansiStrip, nil
+	case ansiStrip, ansiSpans, ansiKeep:
+		return mode, nil
+	default:
+		return "", fmt.Errorf("unknown mode %q (available: strip, spans, keep)", raw)
+	}
+}
+
+// stripANSI removes escape sequences from s.
+func stripANSI(s string) string {
+	if strings.IndexByte(s, 0x1b) < 0 {
+		return s
+	}
+	var b strings.Builder
+	b.Grow(len(s))
+	scanANSI(s, func(text string) { b.WriteString(text) }, nil)
+	return b.String()
+}
+
+// ansiSpansOf splits s into styled runs. It returns nil when no run carries any
+// style, so plain text costs nothing on the wire.
+func ansiSpansOf(s string) []ansiSpan {
+	var spans []ansiSpan
+	var style ansiSpan
+	styled := false
+	scanANSI(s, func(text string) {
+		if n := len(spans); n > 0 && sameANSIStyle(spans[n-1], style) {
+			spans[n-1].Text += text
+			return
+		}
+		span := style
+		span.Text = text
+		spans = append(spans, span)
+		if span != (ansiSpan{Text: text}) {
+			styled = true
+		}
+	}, func(params string) {
+		applySGR(&style, params)
+	})
+	if !styled {
+		return nil
+	}
+	return spans
+}
+
+// scanANSI walks s, passing plain text to text and the parameters of each
+// SGR sequence to sgr. Other CSI, OSC and two-byte escapes are dropped.
+func scanANSI(s string, text func(string), sgr func(string)) {
+	for len(s) > 0 {
+		i := strings.IndexByte(s, 0x1b)
+		if i < 0 {
+			text(s)
+			return
+		}
+		if i > 0 {
+			text(s[:i])
+		}
+		s = s[i+1:]
+		if len(s) == 0 {
+			return
+		}
+		switch s[0] {
+		case '[':
+			end := 1
+			for end < len(s) && (s[end] < 0x40 || s[end] > 0x7e) {
+				end++
+			}
+			if end == len(s) {
+				return
+			}
+			if s[end] == 'm' && sgr != nil {
+				sgr(s[1:end])
+			}
+			s = s[end+1:]
+		case ']':
+			// OSC runs until BEL or ST (ESC \), e.g. hyperlinks.
+			end := strings.IndexAny(s, "\a\x1b")
+			if end < 0 {
+				return
+			}
+			if s[end] == 0x1b && end+1 < len(s) && s[end+1] == '\\' {
+				end++
+			}
+			s = s[end+1:]
+		default:
+			s = s[1:]
+		}
+	}
+}
+
+func sameANSIStyle(a, b ansiSpan) bool {
+	a.Text, b.Text = "", ""
+	return a == b
+}
+
+func applySGR(style *ansiSpan, params string) {
+	if params == "" {
+		*style = ansiSpan{}
+		return
+	}
+	codes := strings.FieldsFunc(params, func(r rune) bool { return r == ';' || r == ':' })
+	for i := 0; i < len(codes); i++ {
+		code, err := strconv.Atoi(codes[i])
+		if err != nil {
+			continue
+		}
+		switch {
+		case code == 0:
+			*style = ansiSpan{}
+		case code == 1:
+			style.Bold = true
+		case code == 2:
+			style.Dim = true
+		case code == 3:
+			style.Italic = true
+		case code == 4:
+			style.Underline = true
+		case code == 22:
+			style.Bold, style.Dim = false, false
+		case code == 23:
+			style.Italic = false
+		case code == 24:
+			style.Underline = false
+		case code >= 30 && code <= 37:
+			style.FG = ansiColorNames[code-30]
+		case code == 39:
+			style.FG = ""
+		case code >= 40 && code <= 47:
+			style.BG = ansiColorNames[code-40]
+		case code == 49:
+			style.BG = ""
+		case code >= 90 && code <= 97:
+			style.FG = "bright-" + ansiColorNames[code-90]
+		case code >= 100 && code <= 107:
+			style.BG = "bright-" + ansiColorNames[code-100]
+		case code == 38 || code == 48:
+			color, used := extendedColor(codes[i+1:])
+			i += used
+			if code == 38 {
+				style.FG = color
+			} else {
+				style.BG = color
+			}
+		}
+	}
+}
+
+// extendedColor decodes the arguments after 38 or 48: "5;n" for the 256-color
+// palette or "2;r;g;b" for truecolor. It returns how many codes it consumed.
+func extendedColor(args []string) (string, int) {
+	if len(args) == 0 {
+		return "", 0
+	}
+	num := func(i int) int {
+		if i >= len(args) {
+			return 0
+		}
+		n, _ := strconv.Atoi(args[i])
+		if n < 0 || n > 255 {
+			return 0
+		}
+		return n
+	}
+	switch args[0] {
+	case "5":
+		return paletteColor(num(1)), 2
+	case "2":
+		return fmt.Sprintf("#%02x%02x%02x", num(1), num(2), num(3)), 4
+	}
+	return "", 1
+}
+
+// paletteColor maps an xterm 256-color index to a color.
+func paletteColor(n int) string {
+	switch {
+	case n < 8:
+		return ansiColorNames[n]
+	case n < 16:
+		return "bright-" + ansiColorNames[n-8]
+	case n < 232:
+		n -= 16
+		steps := []int{0, 95, 135, 175, 215, 255}
+		return fmt.Sprintf("#%02x%02x%02x", steps[n/36], steps[n/6%6], steps[n%6])
+	default:
+		gray := 8 + (n-232)*10
+		return fmt.Sprintf("#%02x%02x%02x", gray, gray, gray)
+	}
+}
+
+// stripANSIFields removes escape sequences from every string inside value,
+// so filters and mapped columns see the same text as the message.
+func stripANSIFields(value interface{}) interface{} {
+	switch v := value.(type) {
+	case map[string]interface{}:
+		for key, child := range v {
+			v[key] = stripANSIFields(child)
+		}
+	case []interface{}:
+		for i, child := range v {
+			v[i] = stripANSIFields(child)
+		}
+	case string:
+		return stripANSI(v)
+	}
+	return value
+}
+
+// applyANSI parses line with escape sequences removed, and in spans mode
+// keeps the styling of the message when it carried any.
+func applyANSI(line string, mode string) LogEntry {
+	stripped := stripANSI(line)
+	entry := parseLine(stripped)
+	if strings.IndexByte(entry.Msg, 0x1b) >= 0 {
+		// JSON strings carry escapes as \u001b, so they survive decoding.
+		if mode == ansiSpans {
+			entry.MsgSpans = ansiSpansOf(entry.Msg)
+		}
+		entry.Msg = stripANSI(entry.Msg)
+	} else if mode == ansiSpans && stripped != line && entry.Msg == stripped {
+		entry.MsgSpans = ansiSpansOf(line)
+	}
+	if strings.Contains(stripped, `\u001b`) || strings.Contains(stripped, `\u001B`) {
+		stripANSIFields(entry.Fields)
+	}
+	return entry
+}
@@ -0,0 +1,179 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"os/exec"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const (
+	defaultCommandTimeout = 30 * time.Second
+	defaultCommandRate    = "10/1m"
+)
+
+// commandAction runs a local program when its rule fires. The triggering
+// entry is written to its stdin as JSON and summarized in ZLOG_* environment
+// variables; whatever it prints is ingested back as entries whose source is
+// command:<rule>.
+type commandAction struct {
+	argv        []string
+	timeout     time.Duration
+	concurrency int
+	rateCount   int
+	ratePer     time.Duration
+
+	running int
+	starts  []time.Time
+}
+
+func newCommandAction(spec alertRuleSpec) (*commandAction, error) {
+	action := &commandAction{argv: spec.Command, timeout: defaultCommandTimeout, concurrency: spec.Concurrency}
+	if action.concurrency < 1 {
+		action.concurrency = 1
+	}
+	if spec.Timeout != "" {
+		timeout, err := time.ParseDuration(spec.Timeout)
+		if err != nil || timeout <= 0 {
+			return nil, fmt.Errorf("invalid timeout %q", spec.Timeout)
+		}
+		action.timeout = timeout
+	}
+	rate := spec.Rate
+	if rate == "" {
+		rate = defaultCommandRate
+	}
+	count, per, ok := strings.Cut(rate, "/")
+	n, err := strconv.Atoi(strings.TrimSpace(count))
+	if !ok || err != nil || n < 1 {
+		return nil, fmt.Errorf("invalid rate %q, want runs/duration such as 10/1m", rate)
+	}
+	if action.ratePer, err = time.ParseDuration(strings.TrimSpace(per)); err != nil || action.ratePer <= 0 {
+		return nil, fmt.Errorf("invalid rate %q, want runs/duration such as 10/1m", rate)
+	}
+	action.rateCount = n
+	return action, nil
+}
+
+// reserve reports why a run cannot start now, or claims a slot for it. The
+// caller holds the alert manager's lock.
+func (a *commandAction) reserve(now time.Time) error {
+	kept := a.starts[:0]
+	for _, start := range a.starts {
+		if now.Sub(start) < a.ratePer {
+			kept = append(kept, start)
+		}
+	}
+	a.starts = kept
+	if a.running >= a.concurrency {
+		return errors.New("skipped: previous run still busy")
+	}
+	if len(a.starts) >= a.rateCount {
+		return errors.New("skipped: rate limited")
+	}
+	a.running++
+	a.starts = append(a.starts, now)
+	return nil
+}
+
+// commandEnv describes the triggering entry to the command.
+func commandEnv(rule string, count int, entry LogEntry) []string {
+	env := append(os.Environ(),
+		"ZLOG_RULE="+rule,
+		"ZLOG_COUNT="+strconv.Itoa(count),
+		"ZLOG_ID="+strconv.FormatInt(entry.ID, 10),
+		"ZLOG_LEVEL="+entry.Level,
+		"ZLOG_MSG="+entry.Msg,
+		"ZLOG_TIME="+entry.Time,
+		"ZLOG_SOURCE="+entry.Source,
+	)
+	if channel := getChannelValue(entry); channel != nil {
+		env = append(env, "ZLOG_CHANNEL="+fmt.Sprint(channel))
+	}
+	return env
+}
+
+// runCommand runs the rule's command for entry and ingests its output. It
+// returns the exit code, or -1 if the command did not run to completion.
+func runCommand(pipeline *Pipeline, rule string, action *commandAction, count int, entry LogEntry) (int, error) {
+	input, err := json.Marshal(entry)
+	if err != nil {
+		return -1, err
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), action.timeout)
+	defer cancel()
+	cmd := exec.CommandContext(ctx, action.argv[0], action.argv[1:]...)
+	cmd.Stdin = bytes.NewReader(append(input, '\n'))
+	cmd.Env = commandEnv(rule, count, entry)
+	cmd.WaitDelay = time.Second
+	output := pipeline.WithSource("command:" + rule)
+	stdout, stderr := &commandOutput{pipeline: output}, &commandOutput{pipeline: output}
+	cmd.Stdout, cmd.Stderr = stdout, stderr
+	err = cmd.Run()
+	stdout.flush()
+	stderr.flush()
+	if ctx.Err() == context.DeadlineExceeded {
+		return -1, fmt.Errorf("timed out after %s", action.timeout)
+	}
+	var exitErr *exec.ExitError
+	if errors.As(err, &exitErr) {
+		return exitErr.ExitCode(), err
+	}
+	if err != nil {
+		return -1, err
+	}
+	return 0, nil
+}
+
+// commandOutput ingests each line a command writes to stdout or stderr.
+type commandOutput struct {
+	pipeline *Pipeline
+	pending  []byte
+}
+
+func (o *commandOutput) Write(p []byte) (int, error) {
+	o.pending = append(o.pending, p...)
+	for {
+		i := bytes.IndexByte(o.pending, '\n')
+		if i < 0 {
+			break
+		}
+		o.ingest(string(o.pending[:i]))
+		o.pending = o.pending[i+1:]
+	}
+	if len(o.pending) > maxScanTokenSize {
+		o.flush()
+	}
+	return len(p), nil
+}
+
+func (o *commandOutput) flush() {
+	if len(o.pending) > 0 {
+		o.ingest(string(o.pending))
+		o.pending = nil
+	}
+}
+
+func (o *commandOutput) ingest(line string) {
+	if strings.TrimSpace(line) != "" {
+		o.pipeline.Ingest(entryFromLine(line))
+	}
+}
+
+// commandFailureEntry reports a failed run in the log itself.
+func commandFailureEntry(rule string, err error) LogEntry {
+	msg := fmt.Sprintf("command for rule %s failed: %v", rule, err)
+	return LogEntry{
+		Ingested: formatTime(time.Now()),
+		Level:    "error",
+		Msg:      msg,
+		Raw:      msg,
+		Source:   "command:" + rule,
+	}
+}
@@ -0,0 +1,45 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"compress/bzip2"
+	"compress/gzip"
+	"fmt"
+	"io"
+
+	"github.com/klauspost/compress/zstd"
+)
+
+var (
+	gzipMagic  = []byte{0x1f, 0x8b}
+	bzip2Magic = []byte("BZh")
+	zstdMagic  = []byte{0x28, 0xb5, 0x2f, 0xfd}
+)
+
+// decompressReader sniffs the first bytes of r and transparently decompresses
+// gzip, bzip2 and zstd streams. Anything else is returned as is. All three
+// readers continue across concatenated members, as produced by `cat *.gz`.
+//
+// Only the bytes of the first read are sniffed, so a live stream whose first
+// line is shorter than a magic number is not held back waiting for more.
+func decompressReader(r io.Reader) (io.ReadCloser, error) {
+	buffered := bufio.NewReaderSize(r, 64*1024)
+	if _, err := buffered.Peek(1); err != nil && err != io.EOF {
+		return nil, err
+	}
+	head, _ := buffered.Peek(min(4, buffered.Buffered()))
+	switch {
+	case bytes.HasPrefix(head, gzipMagic):
+		return gzip.NewReader(buffered)
+	case bytes.HasPrefix(head, bzip2Magic):
+		return io.NopCloser(bzip2.NewReader(buffered)), nil
+	case bytes.HasPrefix(head, zstdMagic):
+		decoder, err := zstd.NewReader(buffered, zstd.WithDecoderConcurrency(1))
+		if err != nil {
+			return nil, fmt.Errorf("zstd: %w", err)
+		}
+		return decoder.IOReadCloser(), nil
+	}
+	return io.NopCloser(buffered), nil
+}
@@ -0,0 +1,213 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+var defaultConfigNames = []string{"config.json", "config.toml", "config.yaml", "config.yml"}
+
+// findDefaultConfig returns the first zlog config file found in the user
+// config directory, or "" when there is none.
+func findDefaultConfig() string {
+	dir, err := os.UserConfigDir()
+	if err != nil {
+		return ""
+	}
+	for _, name := range defaultConfigNames {
+		path := filepath.Join(dir, "zlog", name)
+		if _, err := os.Stat(path); err == nil {
+			return path
+		}
+	}
+	return ""
+}
+
+// loadConfigFile reads option values keyed by flag name. JSON files are
+// decoded as an object; anything else is read as a TOML/YAML subset of
+// "key = value" or "key: value" lines with inline or block lists.
+func loadConfigFile(path string) (map[string]interface{}, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	if strings.EqualFold(filepath.Ext(path), ".json") {
+		decoder := json.NewDecoder(bytes.NewReader(data))
+		decoder.UseNumber()
+		values := map[string]interface{}{}
+		if err := decoder.Decode(&values); err != nil {
+			return nil, err
+		}
+		return values, nil
+	}
+	return parseConfigText(data)
+}
+
+func parseConfigText(data []byte) (map[string]interface{}, error) {
+	values := map[string]interface{}{}
+	scanner := bufio.NewScanner(bytes.NewReader(data))
+	lineNum := 0
+	listKey := ""
+	for scanner.Scan() {
+		lineNum++
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" || strings.HasPrefix(line, "#") || line == "---" {
+			continue
+		}
+		if strings.HasPrefix(line, "- ") || line == "-" {
+			if listKey == "" {
+				return nil, fmt.Errorf("line %d: list item without a key", lineNum)
+			}
+			items, _ := values[listKey].([]interface{})
+			values[listKey] = append(items, unquoteConfigValue(strings.TrimSpace(line[1:])))
+			continue
+		}
+		if strings.HasPrefix(line, "[") {
+			return nil, fmt.Errorf("line %d: sections are not supported", lineNum)
+		}
+		sep := strings.IndexAny(line, "=:")
+		if sep <= 0 {
+			return nil, fmt.Errorf("line %d: expected key = value", lineNum)
+		}
+		key := strings.TrimSpace(line[:sep])
+		raw := strings.TrimSpace(line[sep+1:])
+		listKey = ""
+		switch {
+		case raw == "":
+			listKey = key
+			values[key] = []interface{}{}
+		case strings.HasPrefix(raw, "["):
+			items, err := parseInlineList(raw)
+			if err != nil {
+				return nil, fmt.Errorf("line %d: %w", lineNum, err)
+			}
+			values[key] = items
+		default:
+			values[key] = unquoteConfigValue(raw)
+		}
+	}
+	return values, scanner.Err()
+}
+
+func parseInlineList(raw string) ([]interface{}, error) {
+	if !strings.HasSuffix(raw, "]") {
+		return nil, fmt.Errorf("unterminated list")
+	}
+	body := raw[1 : len(raw)-1]
+	items := []interface{}{}
+	var current strings.Builder
+	var quote byte
+	for i := 0; i < len(body); i++ {
+		ch := body[i]
+		switch {
+		case quote != 0:
+			if ch == '\\' && i+1 < len(body) {
+				current.WriteByte(ch)
+				i++
+				ch = body[i]
+			} else if ch == quote {
+				quote = 0
+			}
+		case ch == '"' || ch == '\'':
+			quote = ch
+		case ch == ',':
+			if item := strings.TrimSpace(current.String()); item != "" {
+				items = append(items, unquoteConfigValue(item))
+			}
+			current.Reset()
+			continue
+		}
+		current.WriteByte(ch)
+	}
+	if quote != 0 {
+		return nil, fmt.Errorf("unterminated string in list")
+	}
+	if item := strings.TrimSpace(current.String()); item != "" {
+		items = append(items, unquoteConfigValue(item))
+	}
+	return items, nil
+}
+
+func unquoteConfigValue(raw string) string {
+	if len(raw) < 2 {
+		return raw
+	}
+	switch {
+	case raw[0] == '"' && raw[len(raw)-1] == '"':
+		if value, err := strconv.Unquote(raw); err == nil {
+			return value
+		}
+	case raw[0] == '\'' && raw[len(raw)-1] == '\'':
+		return raw[1 : len(raw)-1]
+	}
+	return raw
+}
+
+// applyConfig sets every flag named in values that was not given on the
+// command line, so explicit flags always win over the file. Keys may use
+// dashes or underscores.
+func applyConfig(fset *flag.FlagSet, values map[string]interface{}) error {
+	explicit := map[string]bool{}
+	fset.Visit(func(f *flag.Flag) {
+		explicit[f.Name] = true
+	})
+	keys := make([]string, 0, len(values))
+	for key := range values {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	for _, key := range keys {
+		name := strings.ReplaceAll(key, "_", "-")
+		f := fset.Lookup(name)
+		if f == nil || name == "config" {
+			return fmt.Errorf("unknown option %q", key)
+		}
+		if explicit[name] {
+			continue
+		}
+		if err := setFlagFromConfig(fset, name, values[key]); err != nil {
+			return fmt.Errorf("option %q: %w", key, err)
+		}
+	}
+	return nil
+}
+
+func setFlagFromConfig(fset *flag.FlagSet, name string, value interface{}) error {
+	switch v := value.(type) {
+	case []interface{}:
+		for _, item := range v {
+			if err := setFlagFromConfig(fset, name, item); err != nil {
+				return err
+			}
+		}
+		return nil
+	case nil:
+		return errors.New("value is null")
+	case map[string]interface{}:
+		return errors.New("nested objects are not supported")
+	default:
+		return fset.Set(name, fmt.Sprint(v))
+	}
+}
+
+// effectiveOptions reports the merged value of every flag, for /config.
+func effectiveOptions(fset *flag.FlagSet) map[string]interface{} {
+	options := map[string]interface{}{}
+	fset.VisitAll(func(f *flag.Flag) {
+		if getter, ok := f.Value.(flag.Getter); ok {
+			options[f.Name] = getter.Get()
+			return
+		}
+		options[f.Name] = f.Value.String()
+	})
+	return options
+}
@@ -0,0 +1,106 @@
+package main
+
+import (
+	"bytes"
+	"encoding/csv"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"strings"
+	"time"
+)
+
+// Input formats for --format. The default reads one JSON or text entry per
+// line.
+const (
+	formatLines = ""
+	formatCSV   = "csv"
+	formatTSV   = "tsv"
+)
+
+func parseInputFormat(raw string) (string, error) {
+	switch format := strings.ToLower(strings.TrimSpace(raw)); format {
+	case "", "lines", "json":
+		return formatLines, nil
+	case formatCSV, formatTSV, formatJournal:
+		return format, nil
+	default:
+		return "", fmt.Errorf("unknown format %q (available: csv, tsv, journal)", raw)
+	}
+}
+
+// readDelimited ingests CSV or TSV input. The first record is the header and
+// names the fields of every later record; quoted values may span lines.
+func readDelimited(pipeline *Pipeline, r io.Reader, comma rune) error {
+	reader := csv.NewReader(r)
+	reader.Comma = comma
+	reader.FieldsPerRecord = -1
+	reader.LazyQuotes = true
+	header, err := reader.Read()
+	if err == io.EOF {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	header[0] = strings.TrimPrefix(header[0], "\ufeff")
+	for {
+		record, err := reader.Read()
+		if err == io.EOF {
+			return nil
+		}
+		var parseErr *csv.ParseError
+		if errors.As(err, &parseErr) {
+			log.Printf("skipping record: %v", err)
+			continue
+		}
+		if err != nil {
+			return err
+		}
+		pipeline.Ingest(entryFromRecord(header, record, comma))
+	}
+}
+
+// entryFromRecord maps a record onto the header, coercing numbers and
+// booleans, and then detects the message, level and time like a JSON entry.
+// Empty cells are left out.
+func entryFromRecord(header, record []string, comma rune) LogEntry {
+	entry := LogEntry{
+		Raw:      formatRecord(record, comma),
+		Ingested: formatTime(time.Now()),
+	}
+	fields := make(map[string]interface{}, len(record))
+	for i, value := range record {
+		if value == "" {
+			continue
+		}
+		fields[columnName(header, i)] = coerceLiteral(value)
+	}
+	profile := currentProfile()
+	if profile.detector != nil {
+		profile = profile.detector.observe(fields)
+	}
+	applyFields(&entry, fields, profile)
+	return entry
+}
+
+// columnName falls back to col1, col2, ... for records wider than the header
+// and for blank header cells.
+func columnName(header []string, i int) string {
+	if i < len(header) {
+		if name := strings.TrimSpace(header[i]); name != "" {
+			return name
+		}
+	}
+	return fmt.Sprintf("col%d", i+1)
+}
+
+func formatRecord(record []string, comma rune) string {
+	var buf bytes.Buffer
+	writer := csv.NewWriter(&buf)
+	writer.Comma = comma
+	_ = writer.Write(record)
+	writer.Flush()
+	return strings.TrimRight(buf.String(), "\n")
+}
@@ -0,0 +1,136 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strings"
+	"time"
+)
+
+// elasticVersion is what the stand-in reports to clients such as Filebeat
+// that check the cluster version before shipping.
+const elasticVersion = "8.11.0"
+
+// elasticChannelFields make the target index the channel when a document
+// names none itself.
+var elasticChannelFields = []string{"_index"}
+
+// serveElastic stands in for the parts of the Elasticsearch API that log
+// shippers need: the version check at the root, _bulk (optionally under an
+// index), and an acknowledgement for anything else, such as template setup.
+// It is mounted at /es/ so that it does not shadow the UI; point clients
+// there, e.g. Filebeat's output.elasticsearch.path: /es. /_bulk is also
+// served at the root for clients that only post bulk requests.
+func serveElastic(pipeline *Pipeline) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		path := strings.Trim(strings.TrimPrefix(r.URL.Path, "/es"), "/")
+		segments := strings.Split(path, "/")
+		switch {
+		case path == "":
+			writeJSON(w, http.StatusOK, map[string]interface{}{
+				"name":         "zlog",
+				"cluster_name": "zlog",
+				"version": map[string]interface{}{
+					"number":                     elasticVersion,
+					"build_flavor":               "default",
+					"minimum_wire_compatibility": "7.17.0",
+				},
+				"tagline": "You Know, for Search",
+			})
+		case segments[len(segments)-1] == "_bulk":
+			if r.Method != http.MethodPost && r.Method != http.MethodPut {
+				http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+				return
+			}
+			index := ""
+			if len(segments) == 2 {
+				index = segments[0]
+			}
+			serveElasticBulk(pipeline, index, w, r)
+		case r.Method == http.MethodHead:
+			w.WriteHeader(http.StatusOK)
+		default:
+			writeJSON(w, http.StatusOK, map[string]interface{}{"acknowledged": true})
+		}
+	}
+}
+
+// serveElasticBulk ingests a _bulk body: action lines, each followed by a
+// document except for delete. Update actions contribute their "doc". The
+// whole body is validated before anything is ingested, so a client that
+// retries a rejected request does not store its documents twice.
+func serveElasticBulk(pipeline *Pipeline, defaultIndex string, w http.ResponseWriter, r *http.Request) {
+	start := time.Now()
+	body, err := readIngestBody(w, r)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	var items []map[string]interface{}
+	var entries []LogEntry
+	lines := bytes.Split(body, []byte("\n"))
+	for i := 0; i < len(lines); i++ {
+		line := bytes.TrimSpace(lines[i])
+		if len(line) == 0 {
+			continue
+		}
+		var action map[string]map[string]interface{}
+		if err := json.Unmarshal(line, &action); err != nil || len(action) != 1 {
+			http.Error(w, fmt.Sprintf("line %d: expected a bulk action", i+1), http.StatusBadRequest)
+			return
+		}
+		for op, meta := range action {
+			index, _ := meta["_index"].(string)
+			if index == "" {
+				index = defaultIndex
+			}
+			id, _ := meta["_id"].(string)
+			result := map[string]interface{}{"_index": index, "_id": id, "status": http.StatusCreated, "result": "created"}
+			items = append(items, map[string]interface{}{op: result})
+			if op == "delete" {
+				result["status"], result["result"] = http.StatusOK, "not_found"
+				continue
+			}
+			i++
+			for i < len(lines) && len(bytes.TrimSpace(lines[i])) == 0 {
+				i++
+			}
+			if i >= len(lines) {
+				http.Error(w, fmt.Sprintf("%s action without a document", op), http.StatusBadRequest)
+				return
+			}
+			doc := bytes.TrimSpace(lines[i])
+			if op == "update" {
+				var update struct {
+					Doc json.RawMessage `json:"doc"`
+				}
+				if err := json.Unmarshal(doc, &update); err != nil || update.Doc == nil {
+					result["status"], result["result"] = http.StatusOK, "noop"
+					continue
+				}
+				doc = update.Doc
+			}
+			meta := map[string]interface{}{}
+			if index != "" {
+				meta["_index"] = index
+			}
+			entries = append(entries, entryFromPushedLine(string(doc), meta, time.Time{}, elasticChannelFields))
+		}
+	}
+	for _, entry := range entries {
+		pipeline.Ingest(entry)
+	}
+	writeJSON(w, http.StatusOK, map[string]interface{}{
+		"took":   time.Since(start).Milliseconds(),
+		"errors": false,
+		"items":  items,
+	})
+}
+
+func writeJSON(w http.ResponseWriter, status int, value interface{}) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	_ = json.NewEncoder(w).Encode(value)
+}
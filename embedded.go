@@ -0,0 +1,113 @@
+package main
+
+import (
+	"encoding/json"
+	"reflect"
+	"strings"
+)
+
+// maxEmbeddedDepth stops --decode-json from descending forever into values
+// that were encoded several times over.
+const maxEmbeddedDepth = 8
+
+// decodeEmbeddedJSON replaces string values that hold a JSON object or array
+// with the decoded value, so filters can reach inside them. With all set every
+// string is considered except the message; otherwise only the given paths.
+func decodeEmbeddedJSON(fields map[string]interface{}, all bool, paths []fieldPath, skip []fieldPath) {
+	for _, path := range paths {
+		replaceAtPath(fields, path, func(value interface{}) interface{} {
+			if decoded, ok := decodeJSONString(value); ok {
+				return decoded
+			}
+			return value
+		})
+	}
+	if all {
+		decodeAllJSON(fields, nil, skip, 0)
+	}
+}
+
+func decodeAllJSON(value interface{}, path fieldPath, skip []fieldPath, depth int) interface{} {
+	if depth > maxEmbeddedDepth {
+		return value
+	}
+	switch v := value.(type) {
+	case map[string]interface{}:
+		for key, child := range v {
+			v[key] = decodeAllJSON(child, append(path[:len(path):len(path)], key), skip, depth+1)
+		}
+	case []interface{}:
+		for i, child := range v {
+			v[i] = decodeAllJSON(child, append(path[:len(path):len(path)], i), skip, depth+1)
+		}
+	case string:
+		for _, skipped := range skip {
+			if reflect.DeepEqual(skipped, path) {
+				return value
+			}
+		}
+		if decoded, ok := decodeJSONString(v); ok {
+			return decodeAllJSON(decoded, path, skip, depth+1)
+		}
+	}
+	return value
+}
+
+func decodeJSONString(value interface{}) (interface{}, bool) {
+	s, ok := value.(string)
+	if !ok {
+		return nil, false
+	}
+	trimmed := strings.TrimSpace(s)
+	if len(trimmed) < 2 {
+		return nil, false
+	}
+	first, last := trimmed[0], trimmed[len(trimmed)-1]
+	if !(first == '{' && last == '}') && !(first == '[' && last == ']') {
+		return nil, false
+	}
+	var decoded interface{}
+	if err := json.Unmarshal([]byte(trimmed), &decoded); err != nil {
+		return nil, false
+	}
+	return decoded, true
+}
+
+// replaceAtPath applies fn to the value at path, if present.
+func replaceAtPath(fields map[string]interface{}, path fieldPath, fn func(interface{}) interface{}) {
+	if len(path) == 0 {
+		return
+	}
+	var current interface{} = fields
+	for i, segment := range path {
+		last := i == len(path)-1
+		switch key := segment.(type) {
+		case string:
+			obj, ok := current.(map[string]interface{})
+			if !ok {
+				return
+			}
+			value, ok := obj[key]
+			if !ok {
+				return
+			}
+			if last {
+				obj[key] = fn(value)
+				return
+			}
+			current = value
+		case int:
+			list, ok := current.([]interface{})
+			if !ok || key < 0 || key >= len(list) {
+				return
+			}
+			if last {
+				list[key] = fn(list[key])
+				return
+			}
+			current = list[key]
+		default:
+			return
+		}
+	}
+}
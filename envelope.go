@@ -0,0 +1,226 @@
+package main
+
+import (
+	"encoding/json"
+	"regexp"
+	"sort"
+	"strings"
+)
+
+// criLineRegex matches the CRI log format written by containerd and CRI-O:
+// "<RFC3339 time> <stream> <F|P> <content>".
+var criLineRegex = regexp.MustCompile(`^(\d{4}-\d{2}-\d{2}T\S+) (stdout|stderr) ([FP]) ?(.*)$`)
+
+// envelopeTimeKeys are the collector fields used as the entry time when the
+// wrapped log line has none of its own.
+var envelopeTimeKeys = []string{"time", "timestamp", "date", "@timestamp", "criTime"}
+
+// unwrapEnvelope recognises collector envelopes around the real log line and
+// returns the wrapped text plus the remaining metadata fields:
+//   - Docker json-file: {"log": "...", "stream": ..., "time": ...}
+//   - Fluent Bit: {"log": "...", "date": <number>, "stream"/"kubernetes": ...}
+//   - Vector: {"message": "...", "source_type": ..., ...}
+//
+// A log key alone is not enough, so application JSON that happens to use it
+// keeps its own fields.
+func unwrapEnvelope(payload map[string]interface{}) (string, map[string]interface{}, bool) {
+	key := ""
+	if _, ok := payload["log"].(string); ok && (isDockerEnvelope(payload) || isFluentBitEnvelope(payload)) {
+		key = "log"
+	} else if _, ok := payload["message"].(string); ok && hasAnyKey(payload, "source_type") {
+		key = "message"
+	}
+	if key == "" {
+		return "", nil, false
+	}
+	content := strings.TrimRight(payload[key].(string), "\r\n")
+	meta := make(map[string]interface{}, len(payload)-1)
+	for k, v := range payload {
+		if k != key {
+			meta[k] = v
+		}
+	}
+	return content, meta, true
+}
+
+func unwrapCRILine(line string) (string, map[string]interface{}, bool) {
+	match := criLineRegex.FindStringSubmatch(line)
+	if match == nil {
+		return "", nil, false
+	}
+	meta := map[string]interface{}{
+		"criTime": match[1],
+		"stream":  match[2],
+		"criTag":  match[3],
+	}
+	return match[4], meta, true
+}
+
+// parseEnveloped parses the wrapped content like any other line and merges
+// the envelope metadata into its fields. Raw stays the original line.
+func parseEnveloped(line, content string, meta map[string]interface{}) LogEntry {
+	entry := entryFromLine(content)
+	entry.Raw = line
+	if entry.Fields == nil {
+		entry.Fields = map[string]interface{}{}
+	}
+	for key, value := range meta {
+		assignIfMissing(entry.Fields, key, value)
+	}
+	if entry.At.IsZero() {
+		for _, key := range envelopeTimeKeys {
+			if t, ok := parseTimeValue(meta[key]); ok {
+				entry.At = t
+				entry.Time = formatTime(t)
+				break
+			}
+		}
+	}
+	return entry
+}
+
+// isDockerEnvelope reports whether a record with a log key carries the
+// stream and time that Docker's json-file driver always writes.
+func isDockerEnvelope(record map[string]interface{}) bool {
+	return hasAnyKey(record, "stream") && hasAnyKey(record, "time")
+}
+
+// isFluentBitEnvelope reports whether a record with a log key carries Fluent
+// Bit's numeric date alongside its stream or Kubernetes metadata.
+func isFluentBitEnvelope(record map[string]interface{}) bool {
+	if _, ok := record["date"].(float64); !ok {
+		return false
+	}
+	_, isMap := record["kubernetes"].(map[string]interface{})
+	return isMap || hasAnyKey(record, "stream")
+}
+
+func hasAnyKey(fields map[string]interface{}, keys ...string) bool {
+	for _, key := range keys {
+		if _, ok := fields[key]; ok {
+			return true
+		}
+	}
+	return false
+}
+
+// lineAssembler rejoins log lines that the container runtime split into
+// several records: Docker json-file cuts lines at 16 KB and leaves the
+// trailing newline off all but the last piece, and CRI marks pieces with P.
+// Pieces are collected per stream and capped at maxScanTokenSize.
+type lineAssembler struct {
+	partial map[string]*partialLine
+}
+
+// partialLine holds the pieces seen so far and rebuilds a full record around
+// the joined text, using the envelope of the latest piece.
+type partialLine struct {
+	text   strings.Builder
+	finish func(text string) string
+}
+
+func newLineAssembler() *lineAssembler {
+	return &lineAssembler{partial: map[string]*partialLine{}}
+}
+
+// Push returns the next complete line, or false while a split line is still
+// being collected.
+func (a *lineAssembler) Push(line string) (string, bool) {
+	if strings.HasPrefix(line, `{"log":`) {
+		return a.pushDocker(line)
+	}
+	if match := criLineRegex.FindStringSubmatch(line); match != nil {
+		return a.pushCRI(line, match)
+	}
+	return line, true
+}
+
+// Flush returns the lines still being collected, for input that ended in
+// the middle of a split line.
+func (a *lineAssembler) Flush() []string {
+	keys := make([]string, 0, len(a.partial))
+	for key := range a.partial {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	lines := make([]string, 0, len(keys))
+	for _, key := range keys {
+		partial := a.partial[key]
+		lines = append(lines, partial.finish(partial.text.String()))
+		delete(a.partial, key)
+	}
+	return lines
+}
+
+// pushDocker only treats records with both stream and time as json-file
+// output, so that application JSON that happens to have a log key passes
+// through untouched.
+func (a *lineAssembler) pushDocker(line string) (string, bool) {
+	var record map[string]interface{}
+	if err := json.Unmarshal([]byte(line), &record); err != nil {
+		return line, true
+	}
+	text, ok := record["log"].(string)
+	if !ok || !isDockerEnvelope(record) {
+		return line, true
+	}
+	finish := func(joined string) string {
+		record["log"] = joined
+		out, err := json.Marshal(record)
+		if err != nil {
+			return line
+		}
+		return string(out)
+	}
+	key := "docker:" + fmtStream(record["stream"])
+	if !strings.HasSuffix(text, "\n") && a.collect(key, text, finish) {
+		return "", false
+	}
+	partial, ok := a.partial[key]
+	if !ok {
+		return line, true
+	}
+	delete(a.partial, key)
+	partial.text.WriteString(text)
+	return finish(partial.text.String()), true
+}
+
+func (a *lineAssembler) pushCRI(line string, match []string) (string, bool) {
+	finish := func(joined string) string {
+		return match[1] + " " + match[2] + " F " + joined
+	}
+	key := "cri:" + match[2]
+	if match[3] == "P" && a.collect(key, match[4], finish) {
+		return "", false
+	}
+	partial, ok := a.partial[key]
+	if !ok {
+		return line, true
+	}
+	delete(a.partial, key)
+	partial.text.WriteString(match[4])
+	return finish(partial.text.String()), true
+}
+
+// collect appends a piece and reports whether to keep waiting. Once the
+// buffer is full it leaves the piece to the caller, which flushes.
+func (a *lineAssembler) collect(key, piece string, finish func(string) string) bool {
+	partial, ok := a.partial[key]
+	if !ok {
+		partial = &partialLine{}
+		a.partial[key] = partial
+	}
+	if partial.text.Len()+len(piece) > maxScanTokenSize {
+		return false
+	}
+	partial.text.WriteString(piece)
+	partial.finish = finish
+	return true
+}
+
+func fmtStream(value interface{}) string {
+	if stream, ok := value.(string); ok {
+		return stream
+	}
+	return ""
+}
@@ -0,0 +1,12 @@
+//go:build !unix
+
+package main
+
+import (
+	"errors"
+	"os"
+)
+
+func makeFIFO(path string) error {
+	return &os.PathError{Op: "mkfifo", Path: path, Err: errors.ErrUnsupported}
+}
@@ -346,7 +346,7 @@ func coerceLiteral(value string) interface{} {
 	if lower == "null" {
 		return nil
 	}
-	if regexp.MustCompile(`^-?\d+(\.\d+)?$`).MatchString(value) {
+	if captureNumberRegex.MatchString(value) {
 		if num, err := strconv.ParseFloat(value, 64); err == nil {
 			return num
 		}
@@ -394,6 +394,9 @@ func buildFilterScope(entry LogEntry) map[string]interface{} {
 	assignIfMissing(scope, "message", entry.Msg)
 	assignIfMissing(scope, "raw", entry.Raw)
 	assignIfMissing(scope, "parseError", entry.ParseError)
+	if entry.Source != "" {
+		assignIfMissing(scope, "source", entry.Source)
+	}
 	channelValue := getChannelValue(entry)
 	if channelValue != nil {
 		assignIfMissing(scope, "channel", channelValue)
@@ -409,6 +412,9 @@ func assignIfMissing(target map[string]interface{}, key string, value interface{
 }
 
 func getChannelValue(entry LogEntry) interface{} {
+	if entry.Channel != nil {
+		return entry.Channel
+	}
 	if entry.Fields == nil {
 		return nil
 	}
@@ -0,0 +1,214 @@
+package main
+
+import (
+	"bytes"
+	"compress/gzip"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"net"
+	"strings"
+	"time"
+)
+
+// fluentChannelFields name the container for entries from Docker's fluentd
+// driver, which sends {container_name, container_id, source, log}.
+var fluentChannelFields = []string{"container_name", "tag"}
+
+// listenFluentForward accepts the Fluent Forward protocol on addr, as sent by
+// Docker's fluentd log driver and by Fluentd or Fluent Bit forward outputs.
+func listenFluentForward(addr string, pipeline *Pipeline) error {
+	listener, err := net.Listen("tcp", addr)
+	if err != nil {
+		return err
+	}
+	go acceptConnections(listener, "fluent", func(conn net.Conn) {
+		serveFluentForward(conn, pipeline)
+	})
+	return nil
+}
+
+func serveFluentForward(conn net.Conn, pipeline *Pipeline) {
+	reader := newMsgpackReader(conn)
+	for {
+		value, err := reader.Decode()
+		if err != nil {
+			if !errors.Is(err, io.EOF) {
+				log.Printf("fluent %s: %v", conn.RemoteAddr(), err)
+			}
+			return
+		}
+		message, ok := value.([]interface{})
+		if !ok || len(message) < 2 {
+			log.Printf("fluent %s: unexpected message", conn.RemoteAddr())
+			return
+		}
+		option, err := ingestFluentMessage(pipeline, message)
+		if err != nil {
+			log.Printf("fluent %s: %v", conn.RemoteAddr(), err)
+			return
+		}
+		if chunk, ok := option["chunk"].(string); ok {
+			if _, err := conn.Write(fluentAck(chunk)); err != nil {
+				return
+			}
+		}
+	}
+}
+
+// ingestFluentMessage handles the three event modes, told apart by the
+// second element: a time (Message), an array of entries (Forward) or a
+// msgpack stream of entries (PackedForward, optionally gzip compressed).
+func ingestFluentMessage(pipeline *Pipeline, message []interface{}) (map[string]interface{}, error) {
+	tag, _ := message[0].(string)
+	switch events := message[1].(type) {
+	case []interface{}:
+		for _, event := range events {
+			if err := ingestFluentEvent(pipeline, tag, event); err != nil {
+				return nil, err
+			}
+		}
+		return fluentOption(message, 2), nil
+	case []byte, string:
+		option := fluentOption(message, 2)
+		var packed io.Reader
+		if s, ok := events.(string); ok {
+			packed = strings.NewReader(s)
+		} else {
+			packed = bytes.NewReader(events.([]byte))
+		}
+		if option["compressed"] == "gzip" {
+			reader, err := gzip.NewReader(packed)
+			if err != nil {
+				return nil, err
+			}
+			defer reader.Close()
+			packed = io.LimitReader(reader, maxIngestBodySize)
+		}
+		entries := newMsgpackReader(packed)
+		for {
+			event, err := entries.Decode()
+			if err == io.EOF {
+				return option, nil
+			}
+			if err != nil {
+				return nil, err
+			}
+			if err := ingestFluentEvent(pipeline, tag, event); err != nil {
+				return nil, err
+			}
+		}
+	default:
+		if len(message) < 3 {
+			return nil, fmt.Errorf("message mode needs a time and a record")
+		}
+		pipeline.Ingest(entryFromFluent(tag, message[1], message[2]))
+		return fluentOption(message, 3), nil
+	}
+}
+
+func ingestFluentEvent(pipeline *Pipeline, tag string, event interface{}) error {
+	pair, ok := event.([]interface{})
+	if !ok || len(pair) < 2 {
+		return fmt.Errorf("malformed event, want [time, record]")
+	}
+	pipeline.Ingest(entryFromFluent(tag, pair[0], pair[1]))
+	return nil
+}
+
+func fluentOption(message []interface{}, index int) map[string]interface{} {
+	if index >= len(message) {
+		return nil
+	}
+	option, _ := message[index].(map[string]interface{})
+	return option
+}
+
+// entryFromFluent parses the record's log (or message) text like a line
+// from stdin and adds the other record keys and the tag as fields. Records
+// without a text field are used as the entry's fields directly.
+func entryFromFluent(tag string, rawTime, rawRecord interface{}) LogEntry {
+	record, _ := normalizeMsgpack(rawRecord).(map[string]interface{})
+	if record == nil {
+		record = map[string]interface{}{}
+	}
+	at := fluentTime(rawTime)
+	for _, key := range []string{"log", "message"} {
+		line, ok := record[key].(string)
+		if !ok {
+			continue
+		}
+		meta := make(map[string]interface{}, len(record))
+		for k, v := range record {
+			if k != key {
+				meta[k] = v
+			}
+		}
+		if tag != "" {
+			meta["tag"] = tag
+		}
+		return entryFromPushedLine(strings.TrimRight(line, "\r\n"), meta, at, fluentChannelFields)
+	}
+	if tag != "" {
+		assignIfMissing(record, "tag", tag)
+	}
+	entry := entryFromFields(record)
+	if entry.At.IsZero() {
+		setEntryTime(&entry, at)
+	}
+	if entry.Channel == nil && tag != "" {
+		entry.Channel = tag
+	}
+	return entry
+}
+
+// fluentTime reads an integer time in seconds or an EventTime extension,
+// which carries seconds and nanoseconds as two big-endian uint32s.
+func fluentTime(value interface{}) time.Time {
+	switch v := value.(type) {
+	case float64:
+		return time.Unix(int64(v), 0)
+	case msgpackExt:
+		if v.kind == 0 && len(v.data) == 8 {
+			return time.Unix(int64(binary.BigEndian.Uint32(v.data[:4])), int64(binary.BigEndian.Uint32(v.data[4:])))
+		}
+	}
+	return time.Time{}
+}
+
+// normalizeMsgpack turns binary values into strings so records look like
+// decoded JSON.
+func normalizeMsgpack(value interface{}) interface{} {
+	switch v := value.(type) {
+	case []byte:
+		return string(v)
+	case msgpackExt:
+		return fmt.Sprintf("%x", v.data)
+	case []interface{}:
+		for i, item := range v {
+			v[i] = normalizeMsgpack(item)
+		}
+	case map[string]interface{}:
+		for key, item := range v {
+			v[key] = normalizeMsgpack(item)
+		}
+	}
+	return value
+}
+
+// fluentAck encodes the {"ack": chunk} response that at-least-once clients
+// wait for.
+func fluentAck(chunk string) []byte {
+	buf := []byte{0x81, 0xa3, 'a', 'c', 'k'}
+	switch n := len(chunk); {
+	case n < 32:
+		buf = append(buf, 0xa0|byte(n))
+	case n < 256:
+		buf = append(buf, 0xd9, byte(n))
+	default:
+		buf = append(buf, 0xda, byte(n>>8), byte(n))
+	}
+	return append(buf, chunk...)
+}
@@ -0,0 +1,299 @@
+package main
+
+import (
+	"bytes"
+	"compress/gzip"
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"log"
+	"net"
+	"net/http"
+	"net/url"
+	"slices"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+const (
+	forwardBatchSize     = 500
+	forwardFlushInterval = time.Second
+	forwardMinBackoff    = 500 * time.Millisecond
+	forwardMaxBackoff    = 30 * time.Second
+	forwardTimeout       = 30 * time.Second
+)
+
+// instanceID tells this zlog apart from others it forwards to or receives
+// from, so that entries going round a loop of --forward targets are dropped.
+var instanceID = newInstanceID()
+
+func newInstanceID() string {
+	buf := make([]byte, 8)
+	_, _ = rand.Read(buf)
+	return hex.EncodeToString(buf)
+}
+
+// forwardedEntry is the wire form of an entry sent to another zlog's /ingest
+// endpoint. At carries the parsed time, which LogEntry leaves out of its JSON,
+// and Via the instances the entry has passed through.
+type forwardedEntry struct {
+	LogEntry
+	At  *time.Time `json:"at,omitempty"`
+	Via []string   `json:"via,omitempty"`
+}
+
+// forwarder ships stored entries to a remote zlog in batches. Entries wait in
+// a bounded queue while the remote is unreachable; when the queue is full the
+// oldest are dropped.
+type forwarder struct {
+	url    string
+	host   string
+	client *http.Client
+
+	mu      sync.Mutex
+	queue   []LogEntry
+	max     int
+	dropped int
+	wake    chan struct{}
+}
+
+// newForwarder sends to target's /ingest endpoint, labelling entries with
+// host and keeping up to buffer entries during outages. listenAddr is this
+// instance's own address, which target may not point back to.
+func newForwarder(target, host string, buffer int, listenAddr string) (*forwarder, error) {
+	parsed, err := url.Parse(target)
+	if err != nil {
+		return nil, err
+	}
+	if parsed.Scheme != "http" && parsed.Scheme != "https" || parsed.Host == "" {
+		return nil, fmt.Errorf("%q is not an http(s) URL", target)
+	}
+	if isOwnAddress(parsed, listenAddr) {
+		return nil, fmt.Errorf("%s is this zlog's own address", target)
+	}
+	if parsed.Path == "" || parsed.Path == "/" {
+		parsed.Path = "/ingest"
+	}
+	if buffer < 1 {
+		buffer = 1
+	}
+	f := &forwarder{
+		url:    parsed.String(),
+		host:   host,
+		client: &http.Client{Timeout: forwardTimeout},
+		max:    buffer,
+		wake:   make(chan struct{}, 1),
+	}
+	go f.run()
+	return f, nil
+}
+
+// Write queues an entry with the host label added: a host field when the
+// entry has none, and the host as a prefix of its source. Entries that
+// already passed through this instance are not sent again.
+func (f *forwarder) Write(entry LogEntry) {
+	if slices.Contains(entry.Via, instanceID) {
+		return
+	}
+	if f.host != "" {
+		fields := make(map[string]interface{}, len(entry.Fields)+1)
+		for key, value := range entry.Fields {
+			fields[key] = value
+		}
+		assignIfMissing(fields, "host", f.host)
+		entry.Fields = fields
+		entry.Source = f.host + "/" + entry.Source
+	}
+	f.mu.Lock()
+	if len(f.queue) >= f.max {
+		f.queue = f.queue[1:]
+		f.dropped++
+	}
+	f.queue = append(f.queue, entry)
+	full := len(f.queue) >= forwardBatchSize
+	f.mu.Unlock()
+	if full {
+		select {
+		case f.wake <- struct{}{}:
+		default:
+		}
+	}
+}
+
+func (f *forwarder) take() []LogEntry {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	n := min(len(f.queue), forwardBatchSize)
+	batch := append([]LogEntry(nil), f.queue[:n]...)
+	f.queue = f.queue[n:]
+	return batch
+}
+
+func (f *forwarder) run() {
+	ticker := time.NewTicker(forwardFlushInterval)
+	defer ticker.Stop()
+	var batch []LogEntry
+	var backoff time.Duration
+	failures := 0
+	for {
+		if len(batch) == 0 {
+			if batch = f.take(); len(batch) == 0 {
+				select {
+				case <-ticker.C:
+				case <-f.wake:
+				}
+				continue
+			}
+		}
+		retry, err := f.post(batch)
+		if err == nil || !retry {
+			if err != nil {
+				log.Printf("forward: dropping %d entries: %v", len(batch), err)
+			}
+			if failures > 0 {
+				f.mu.Lock()
+				dropped := f.dropped
+				f.dropped = 0
+				f.mu.Unlock()
+				log.Printf("forward: %s reachable again after %d failed attempts (%d entries dropped)", f.url, failures, dropped)
+			}
+			batch, backoff, failures = nil, 0, 0
+			continue
+		}
+		if failures == 0 {
+			log.Printf("forward: %v; retrying with backoff", err)
+		}
+		failures++
+		backoff = min(max(backoff*2, forwardMinBackoff), forwardMaxBackoff)
+		time.Sleep(backoff)
+	}
+}
+
+// post sends one gzipped NDJSON batch. It reports whether a failure is worth
+// retrying: network errors, 5xx, 408 and 429 are, other statuses are not.
+func (f *forwarder) post(batch []LogEntry) (bool, error) {
+	var body bytes.Buffer
+	compressor := gzip.NewWriter(&body)
+	encoder := json.NewEncoder(compressor)
+	for _, entry := range batch {
+		wire := forwardedEntry{LogEntry: entry, Via: append(slices.Clip(entry.Via), instanceID)}
+		if !entry.At.IsZero() {
+			wire.At = &entry.At
+		}
+		if err := encoder.Encode(wire); err != nil {
+			return false, err
+		}
+	}
+	if err := compressor.Close(); err != nil {
+		return false, err
+	}
+	req, err := http.NewRequest(http.MethodPost, f.url, &body)
+	if err != nil {
+		return false, err
+	}
+	req.Header.Set("Content-Type", "application/x-ndjson")
+	req.Header.Set("Content-Encoding", "gzip")
+	resp, err := f.client.Do(req)
+	if err != nil {
+		return true, err
+	}
+	defer resp.Body.Close()
+	detail, _ := io.ReadAll(io.LimitReader(resp.Body, 512))
+	if resp.StatusCode >= 200 && resp.StatusCode < 300 {
+		return false, nil
+	}
+	err = fmt.Errorf("%s: %s %s", f.url, resp.Status, strings.TrimSpace(string(detail)))
+	retry := resp.StatusCode >= 500 || resp.StatusCode == http.StatusRequestTimeout || resp.StatusCode == http.StatusTooManyRequests
+	return retry, err
+}
+
+// serveIngest accepts entries forwarded by another zlog as NDJSON. They keep
+// the parse results, source and host label of the sending instance; their
+// time is shown in this instance's time zone. Entries that this instance
+// already forwarded once have come round a loop and are dropped.
+func serveIngest(pipeline *Pipeline) http.HandlerFunc {
+	var looped atomic.Int64
+	return func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodPost {
+			http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+			return
+		}
+		body, err := readIngestBody(w, r)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		var entries []LogEntry
+		for i, line := range bytes.Split(body, []byte("\n")) {
+			if len(bytes.TrimSpace(line)) == 0 {
+				continue
+			}
+			var wire forwardedEntry
+			if err := json.Unmarshal(line, &wire); err != nil {
+				http.Error(w, fmt.Sprintf("line %d: %v", i+1, err), http.StatusBadRequest)
+				return
+			}
+			if slices.Contains(wire.Via, instanceID) {
+				if looped.Add(1) == 1 {
+					log.Printf("ingest: dropping entries that were forwarded in a loop back to this zlog")
+				}
+				continue
+			}
+			entry := wire.LogEntry
+			entry.ID, entry.SentMs, entry.Via = 0, 0, wire.Via
+			if wire.At != nil {
+				entry.At = *wire.At
+				entry.Time = formatTime(entry.At)
+			}
+			entries = append(entries, entry)
+		}
+		for _, entry := range entries {
+			pipeline.Ingest(entry)
+		}
+		writeJSON(w, http.StatusOK, map[string]interface{}{"accepted": len(entries)})
+	}
+}
+
+// isOwnAddress reports whether target resolves to the address this instance
+// listens on. A wildcard listen address matches any local interface.
+func isOwnAddress(target *url.URL, listenAddr string) bool {
+	listenHost, listenPort, err := net.SplitHostPort(listenAddr)
+	if err != nil {
+		return false
+	}
+	port := target.Port()
+	if port == "" {
+		port = map[string]string{"http": "80", "https": "443"}[target.Scheme]
+	}
+	if port != listenPort {
+		return false
+	}
+	targetIPs, err := net.LookupIP(target.Hostname())
+	if err != nil {
+		return false
+	}
+	var ownIPs []net.IP
+	if ip := net.ParseIP(listenHost); ip != nil && !ip.IsUnspecified() {
+		ownIPs = []net.IP{ip}
+	} else if ip == nil && listenHost != "" {
+		ownIPs, _ = net.LookupIP(listenHost)
+	} else if addrs, err := net.InterfaceAddrs(); err == nil {
+		for _, addr := range addrs {
+			if ipNet, ok := addr.(*net.IPNet); ok {
+				ownIPs = append(ownIPs, ipNet.IP)
+			}
+		}
+	}
+	for _, targetIP := range targetIPs {
+		for _, ownIP := range ownIPs {
+			if targetIP.Equal(ownIP) {
+				return true
+			}
+		}
+	}
+	return false
+}
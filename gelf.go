@@ -0,0 +1,219 @@
+package main
+
+import (
+	"bytes"
+	"compress/gzip"
+	"compress/zlib"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"net"
+	"strings"
+	"time"
+)
+
+const (
+	// gelfMaxChunks is the limit the GELF spec puts on one chunked message.
+	gelfMaxChunks = 128
+	// gelfChunkTimeout drops chunked messages that never complete.
+	gelfChunkTimeout = 5 * time.Second
+	gelfMaxDatagram  = 65536
+)
+
+var gelfChunkMagic = []byte{0x1e, 0x0f}
+
+// gelfChannelFields name the container for entries from Docker's gelf driver.
+var gelfChannelFields = []string{"container_name", "tag"}
+
+// listenGELF accepts GELF messages on addr over both UDP (chunked and
+// optionally zlib or gzip compressed) and TCP (null-byte delimited).
+func listenGELF(addr string, pipeline *Pipeline) error {
+	packets, err := net.ListenPacket("udp", addr)
+	if err != nil {
+		return err
+	}
+	listener, err := net.Listen("tcp", addr)
+	if err != nil {
+		packets.Close()
+		return err
+	}
+	go serveGELFUDP(packets, pipeline)
+	go acceptConnections(listener, "gelf", func(conn net.Conn) {
+		serveGELFTCP(conn, pipeline)
+	})
+	return nil
+}
+
+// acceptConnections runs handle for every connection on listener.
+func acceptConnections(listener net.Listener, name string, handle func(net.Conn)) {
+	for {
+		conn, err := listener.Accept()
+		if err != nil {
+			if errors.Is(err, net.ErrClosed) {
+				return
+			}
+			log.Printf("%s accept error: %v", name, err)
+			continue
+		}
+		go func() {
+			defer conn.Close()
+			handle(conn)
+		}()
+	}
+}
+
+type gelfChunks struct {
+	parts    [][]byte
+	received int
+	started  time.Time
+}
+
+func serveGELFUDP(packets net.PacketConn, pipeline *Pipeline) {
+	pending := map[string]*gelfChunks{}
+	buf := make([]byte, gelfMaxDatagram)
+	for {
+		n, _, err := packets.ReadFrom(buf)
+		if err != nil {
+			if errors.Is(err, net.ErrClosed) {
+				return
+			}
+			log.Printf("gelf read error: %v", err)
+			continue
+		}
+		datagram := append([]byte(nil), buf[:n]...)
+		if bytes.HasPrefix(datagram, gelfChunkMagic) {
+			message, ok := collectGELFChunk(pending, datagram)
+			if !ok {
+				continue
+			}
+			datagram = message
+		}
+		payload, err := decompressGELF(datagram)
+		if err != nil {
+			log.Printf("gelf: %v", err)
+			continue
+		}
+		ingestGELF(pipeline, payload)
+	}
+}
+
+// collectGELFChunk stores one chunk and returns the whole message once every
+// chunk has arrived. Chunks are 12-byte headers (magic, message id, sequence
+// number, count) followed by a slice of the message.
+func collectGELFChunk(pending map[string]*gelfChunks, datagram []byte) ([]byte, bool) {
+	now := time.Now()
+	for id, chunks := range pending {
+		if now.Sub(chunks.started) > gelfChunkTimeout {
+			delete(pending, id)
+		}
+	}
+	if len(datagram) < 12 {
+		return nil, false
+	}
+	id := string(datagram[2:10])
+	seq, count := int(datagram[10]), int(datagram[11])
+	if count == 0 || count > gelfMaxChunks || seq >= count {
+		return nil, false
+	}
+	chunks, ok := pending[id]
+	if !ok {
+		chunks = &gelfChunks{parts: make([][]byte, count), started: now}
+		pending[id] = chunks
+	}
+	if len(chunks.parts) != count || chunks.parts[seq] != nil {
+		return nil, false
+	}
+	chunks.parts[seq] = datagram[12:]
+	chunks.received++
+	if chunks.received < count {
+		return nil, false
+	}
+	delete(pending, id)
+	return bytes.Join(chunks.parts, nil), true
+}
+
+func decompressGELF(payload []byte) ([]byte, error) {
+	var reader io.ReadCloser
+	var err error
+	switch {
+	case bytes.HasPrefix(payload, gzipMagic):
+		reader, err = gzip.NewReader(bytes.NewReader(payload))
+	case len(payload) > 1 && payload[0] == 0x78:
+		reader, err = zlib.NewReader(bytes.NewReader(payload))
+	default:
+		return payload, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	defer reader.Close()
+	return io.ReadAll(io.LimitReader(reader, maxScanTokenSize))
+}
+
+func serveGELFTCP(conn net.Conn, pipeline *Pipeline) {
+	scanner := newLineScanner(conn)
+	scanner.Split(splitNullDelimited)
+	for scanner.Scan() {
+		if len(bytes.TrimSpace(scanner.Bytes())) == 0 {
+			continue
+		}
+		ingestGELF(pipeline, scanner.Bytes())
+	}
+	if err := scanner.Err(); err != nil {
+		log.Printf("gelf %s: %v", conn.RemoteAddr(), err)
+	}
+}
+
+// splitNullDelimited is a bufio.SplitFunc for GELF TCP framing.
+func splitNullDelimited(data []byte, atEOF bool) (int, []byte, error) {
+	if i := bytes.IndexByte(data, 0); i >= 0 {
+		return i + 1, data[:i], nil
+	}
+	if atEOF && len(data) > 0 {
+		return len(data), data, nil
+	}
+	return 0, nil, nil
+}
+
+func ingestGELF(pipeline *Pipeline, payload []byte) {
+	entry, err := entryFromGELF(payload)
+	if err != nil {
+		log.Printf("gelf: %v", err)
+		return
+	}
+	pipeline.Ingest(entry)
+}
+
+// entryFromGELF parses short_message like a line from stdin, so JSON logged
+// by a container keeps its own fields, and adds the GELF envelope: additional
+// fields without their leading underscore, host and full_message. The GELF
+// timestamp and syslog level apply when the message has none of its own.
+func entryFromGELF(payload []byte) (LogEntry, error) {
+	var message map[string]interface{}
+	if err := json.Unmarshal(payload, &message); err != nil {
+		return LogEntry{}, fmt.Errorf("invalid message: %w", err)
+	}
+	short, _ := message["short_message"].(string)
+	meta := map[string]interface{}{}
+	for key, value := range message {
+		switch {
+		case key == "_id":
+		case strings.HasPrefix(key, "_"):
+			meta[key[1:]] = value
+		case key == "host" || key == "full_message" || key == "facility" || key == "file" || key == "line":
+			meta[key] = value
+		}
+	}
+	var at time.Time
+	if ts, ok := message["timestamp"].(float64); ok {
+		at, _ = timeFromNumber(ts)
+	}
+	entry := entryFromPushedLine(strings.TrimRight(short, "\r\n"), meta, at, gelfChannelFields)
+	entry.Raw = string(payload)
+	if level, ok := message["level"].(float64); ok && !hasLevel(entry) {
+		entry.Level, entry.LevelNum = levelOnScale("syslog", int(level))
+	}
+	return entry, nil
+}
@@ -1,3 +1,5 @@
 module github.com/w9/zlog
 
 go 1.25.5
+
+require github.com/klauspost/compress v1.20.1
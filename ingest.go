@@ -0,0 +1,114 @@
+package main
+
+import (
+	"compress/gzip"
+	"compress/zlib"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+	"time"
+)
+
+// maxIngestBodySize caps a single push request after decompression.
+const maxIngestBodySize = 64 << 20
+
+// readIngestBody returns the request body of a push endpoint, undoing gzip or
+// deflate Content-Encoding.
+func readIngestBody(w http.ResponseWriter, r *http.Request) ([]byte, error) {
+	var body io.Reader = http.MaxBytesReader(w, r.Body, maxIngestBodySize)
+	switch strings.ToLower(strings.TrimSpace(r.Header.Get("Content-Encoding"))) {
+	case "", "identity":
+	case "gzip":
+		reader, err := gzip.NewReader(body)
+		if err != nil {
+			return nil, err
+		}
+		defer reader.Close()
+		body = reader
+	case "deflate":
+		reader, err := zlib.NewReader(body)
+		if err != nil {
+			return nil, err
+		}
+		defer reader.Close()
+		body = reader
+	default:
+		return nil, fmt.Errorf("unsupported Content-Encoding %q", r.Header.Get("Content-Encoding"))
+	}
+	data, err := io.ReadAll(io.LimitReader(body, maxIngestBodySize+1))
+	if err != nil {
+		return nil, err
+	}
+	if len(data) > maxIngestBodySize {
+		return nil, errors.New("request body too large")
+	}
+	return data, nil
+}
+
+// isProtobufRequest reports whether the client sent a protobuf body.
+func isProtobufRequest(r *http.Request) bool {
+	return strings.Contains(r.Header.Get("Content-Type"), "protobuf")
+}
+
+// entryFromFields builds an entry for records that arrive already structured
+// over a push protocol. Raw is the JSON form of the fields.
+func entryFromFields(fields map[string]interface{}) LogEntry {
+	raw, err := json.Marshal(fields)
+	if err != nil {
+		raw = []byte(fmt.Sprint(fields))
+	}
+	entry := LogEntry{
+		Raw:      string(raw),
+		Ingested: formatTime(time.Now()),
+	}
+	applyFields(&entry, fields, currentProfile())
+	return entry
+}
+
+// entryFromPushedLine parses a line received over a log protocol like any
+// other input and adds the protocol metadata as fields, without replacing
+// fields the line has itself. at is used when the line carries no time, and
+// the channel falls back to the first of channelFallbacks found in meta.
+func entryFromPushedLine(line string, meta map[string]interface{}, at time.Time, channelFallbacks []string) LogEntry {
+	entry := entryFromLine(line)
+	if entry.Fields == nil {
+		entry.Fields = map[string]interface{}{}
+	}
+	for key, value := range meta {
+		assignIfMissing(entry.Fields, key, value)
+	}
+	if entry.At.IsZero() {
+		setEntryTime(&entry, at)
+	}
+	if entry.Channel == nil {
+		if channel, ok := extractChannel(entry.Fields); ok {
+			entry.Channel = channel
+		}
+	}
+	if entry.Channel == nil {
+		for _, key := range channelFallbacks {
+			if value, ok := meta[key]; ok && value != nil && value != "" {
+				entry.Channel = value
+				break
+			}
+		}
+	}
+	return entry
+}
+
+// hasLevel reports whether the entry got a level from its own content.
+func hasLevel(entry LogEntry) bool {
+	return entry.Level != "unknown" && entry.Level != "plain"
+}
+
+// setEntryTime overrides the entry time with one the protocol supplies.
+func setEntryTime(entry *LogEntry, t time.Time) {
+	if t.IsZero() {
+		return
+	}
+	entry.At = t
+	entry.Time = formatTime(t)
+}
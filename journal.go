@@ -0,0 +1,166 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/binary"
+	"encoding/json"
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// formatJournal reads the `journalctl -o export` stream format. It is also
+// picked automatically when line input starts like an export stream.
+const formatJournal = "journal"
+
+var journalExportPrefix = []byte("__CURSOR=")
+
+// startsLikeJournalExport reports whether r begins with an export stream. It
+// only waits for more input while what has arrived still matches the prefix,
+// so a short first line of a live stream is not held back.
+func startsLikeJournalExport(r *bufio.Reader) bool {
+	if _, err := r.Peek(1); err != nil {
+		return false
+	}
+	head, _ := r.Peek(min(len(journalExportPrefix), r.Buffered()))
+	if !bytes.HasPrefix(journalExportPrefix, head) {
+		return false
+	}
+	head, _ = r.Peek(len(journalExportPrefix))
+	return bytes.Equal(head, journalExportPrefix)
+}
+
+// journalChannelFields name the process behind a journal entry.
+var journalChannelFields = []string{"SYSLOG_IDENTIFIER", "_SYSTEMD_UNIT", "_COMM"}
+
+// isJournalEntry recognises the objects `journalctl -o json` writes.
+func isJournalEntry(fields map[string]interface{}) bool {
+	if _, ok := fields["__REALTIME_TIMESTAMP"]; !ok {
+		return false
+	}
+	return hasAnyKey(fields, "MESSAGE", "__CURSOR", "PRIORITY")
+}
+
+// entryFromJournal maps a journal entry: MESSAGE is parsed like a line from
+// stdin, so JSON logged to the journal keeps its fields, and the remaining
+// journal fields are added alongside. __REALTIME_TIMESTAMP (microseconds)
+// and PRIORITY (syslog scale) apply when the message has no time or level of
+// its own. Raw is the original line.
+func entryFromJournal(raw string, fields map[string]interface{}) LogEntry {
+	for key, value := range fields {
+		fields[key] = decodeJournalBytes(value)
+	}
+	message, _ := fields["MESSAGE"].(string)
+	meta := make(map[string]interface{}, len(fields))
+	for key, value := range fields {
+		if key != "MESSAGE" {
+			meta[key] = value
+		}
+	}
+	var at time.Time
+	if micros, err := strconv.ParseInt(fmt.Sprint(fields["__REALTIME_TIMESTAMP"]), 10, 64); err == nil {
+		at = time.UnixMicro(micros)
+	}
+	entry := entryFromPushedLine(strings.TrimRight(message, "\r\n"), meta, at, journalChannelFields)
+	entry.Raw = raw
+	if !hasLevel(entry) {
+		if priority, err := strconv.Atoi(fmt.Sprint(fields["PRIORITY"])); err == nil {
+			entry.Level, entry.LevelNum = levelOnScale("syslog", priority)
+		}
+	}
+	return entry
+}
+
+// decodeJournalBytes turns the byte arrays journalctl uses for values that
+// are not valid UTF-8 or contain control characters back into strings.
+func decodeJournalBytes(value interface{}) interface{} {
+	list, ok := value.([]interface{})
+	if !ok || len(list) == 0 {
+		return value
+	}
+	buf := make([]byte, 0, len(list))
+	for _, item := range list {
+		num, ok := item.(float64)
+		if !ok || num < 0 || num > 255 || num != float64(int(num)) {
+			return value
+		}
+		buf = append(buf, byte(num))
+	}
+	return string(buf)
+}
+
+// readJournalExport ingests the export format: entries of KEY=value lines
+// separated by a blank line. Values that are binary or contain newlines are
+// written as the key on its own line, a little-endian uint64 length, the
+// data and a newline.
+func readJournalExport(pipeline *Pipeline, r io.Reader) error {
+	reader := bufio.NewReaderSize(r, 64*1024)
+	fields := map[string]interface{}{}
+	flush := func() {
+		if len(fields) == 0 {
+			return
+		}
+		raw, err := json.Marshal(fields)
+		if err != nil {
+			raw = []byte(fmt.Sprint(fields))
+		}
+		pipeline.Ingest(entryFromJournal(string(raw), fields))
+		fields = map[string]interface{}{}
+	}
+	for {
+		line, err := readJournalLine(reader)
+		if err == io.EOF {
+			flush()
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+		if len(line) == 0 {
+			flush()
+			continue
+		}
+		if eq := bytes.IndexByte(line, '='); eq >= 0 {
+			fields[string(line[:eq])] = string(line[eq+1:])
+			continue
+		}
+		var size uint64
+		if err := binary.Read(reader, binary.LittleEndian, &size); err != nil {
+			return fmt.Errorf("journal field %s: %w", line, err)
+		}
+		if size > maxScanTokenSize {
+			return fmt.Errorf("journal field %s: %d bytes is too large", line, size)
+		}
+		data := make([]byte, size+1)
+		if _, err := io.ReadFull(reader, data); err != nil {
+			return fmt.Errorf("journal field %s: %w", line, err)
+		}
+		fields[string(line)] = string(data[:size])
+	}
+}
+
+// readJournalLine reads one line without its newline, up to
+// maxScanTokenSize bytes.
+func readJournalLine(reader *bufio.Reader) ([]byte, error) {
+	var line []byte
+	for {
+		chunk, err := reader.ReadSlice('\n')
+		line = append(line, chunk...)
+		if len(line) > maxScanTokenSize {
+			return nil, bufio.ErrTooLong
+		}
+		if err == bufio.ErrBufferFull {
+			continue
+		}
+		if err == io.EOF && len(line) > 0 {
+			return line, nil
+		}
+		if err != nil {
+			return nil, err
+		}
+		return line[:len(line)-1], nil
+	}
+}
@@ -0,0 +1,111 @@
+package main
+
+import (
+	"fmt"
+	"strings"
+)
+
+// fieldPath is a parsed filter-style path such as .log.level or .tags[0].
+type fieldPath []interface{}
+
+// parseFieldPath accepts the path part of a filter expression, with or
+// without the leading dot: "log.level", ".log.level", `."log.level"`.
+func parseFieldPath(raw string) (fieldPath, error) {
+	trimmed := strings.TrimSpace(raw)
+	if trimmed == "" {
+		return nil, fmt.Errorf("field path is empty")
+	}
+	if !strings.HasPrefix(trimmed, ".") {
+		trimmed = "." + trimmed
+	}
+	result, err := parsePathExpression(trimmed)
+	if err != nil {
+		return nil, err
+	}
+	if rest := strings.TrimSpace(result.rest); rest != "" {
+		return nil, fmt.Errorf("unexpected %q after field path", rest)
+	}
+	if len(result.path) == 0 {
+		return nil, fmt.Errorf("field path is empty")
+	}
+	return fieldPath(result.path), nil
+}
+
+func parseFieldPaths(raw []string) ([]fieldPath, error) {
+	paths := make([]fieldPath, 0, len(raw))
+	for _, value := range raw {
+		path, err := parseFieldPath(value)
+		if err != nil {
+			return nil, fmt.Errorf("%q: %w", value, err)
+		}
+		paths = append(paths, path)
+	}
+	return paths, nil
+}
+
+func mustParseFieldPaths(raw ...string) []fieldPath {
+	paths, err := parseFieldPaths(raw)
+	if err != nil {
+		panic(err)
+	}
+	return paths
+}
+
+// lookupField resolves path in fields. A path made only of names also
+// matches a flat key with dots in it, so .log.level finds both
+// {"log":{"level":...}} and {"log.level":...}.
+func lookupField(fields map[string]interface{}, path fieldPath) (interface{}, bool) {
+	var current interface{} = fields
+	found := true
+	for _, segment := range path {
+		switch key := segment.(type) {
+		case string:
+			obj, ok := current.(map[string]interface{})
+			if !ok {
+				found = false
+				break
+			}
+			current, ok = obj[key]
+			found = ok
+		case int:
+			list, ok := current.([]interface{})
+			if !ok || key < 0 || key >= len(list) {
+				found = false
+				break
+			}
+			current = list[key]
+		}
+		if !found {
+			break
+		}
+	}
+	if found {
+		return current, true
+	}
+	if len(path) > 1 {
+		names := make([]string, 0, len(path))
+		for _, segment := range path {
+			name, ok := segment.(string)
+			if !ok {
+				return nil, false
+			}
+			names = append(names, name)
+		}
+		value, ok := fields[strings.Join(names, ".")]
+		return value, ok
+	}
+	return nil, false
+}
+
+// setFieldKeys replaces target with the parsed paths when any were given.
+func setFieldKeys(target *[]fieldPath, raw []string) error {
+	if len(raw) == 0 {
+		return nil
+	}
+	paths, err := parseFieldPaths(raw)
+	if err != nil {
+		return err
+	}
+	*target = paths
+	return nil
+}
@@ -0,0 +1,186 @@
+package main
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+)
+
+type levelDef struct {
+	name     string
+	num      int
+	fallback string
+}
+
+// canonicalLevels lists every level zlog can assign, by severity. Levels with
+// a fallback are opt-in via --extra-levels and fold into the fallback
+// otherwise, so existing setups keep their six-step scale.
+var canonicalLevels = []levelDef{
+	{name: "trace", num: 10},
+	{name: "debug", num: 20},
+	{name: "info", num: 30},
+	{name: "notice", num: 35, fallback: "info"},
+	{name: "warn", num: 40},
+	{name: "error", num: 50},
+	{name: "critical", num: 55, fallback: "fatal"},
+	{name: "fatal", num: 60},
+}
+
+// levelScales map a numeric level to a canonical level name. pino is the
+// default and also covers bunyan; the others are selected with --level-scale.
+var levelScales = map[string]func(int) string{
+	"pino": func(num int) string {
+		switch {
+		case num >= 60:
+			return "fatal"
+		case num >= 50:
+			return "error"
+		case num >= 40:
+			return "warn"
+		case num >= 30:
+			return "info"
+		case num >= 20:
+			return "debug"
+		case num >= 10:
+			return "trace"
+		default:
+			return "unknown"
+		}
+	},
+	// syslog severities run from 0 (emerg) to 7 (debug).
+	"syslog": func(num int) string {
+		names := []string{"fatal", "fatal", "critical", "error", "warn", "notice", "info", "debug"}
+		if num < 0 || num >= len(names) {
+			return "unknown"
+		}
+		return names[num]
+	},
+	// OpenTelemetry SeverityNumber groups 1-24 into six ranges of four.
+	"otel": func(num int) string {
+		names := []string{"trace", "debug", "info", "warn", "error", "fatal"}
+		if num < 1 || num > 24 {
+			return "unknown"
+		}
+		return names[(num-1)/4]
+	},
+	// .NET LogLevel and Serilog LogEventLevel both count up from 0 (trace).
+	"dotnet": func(num int) string {
+		names := []string{"trace", "debug", "info", "warn", "error", "critical"}
+		if num < 0 || num >= len(names) {
+			return "unknown"
+		}
+		return names[num]
+	},
+	// Google Cloud LogSeverity steps by 100 from DEFAULT (0) to EMERGENCY (800).
+	"gcp": func(num int) string {
+		names := []string{"unknown", "debug", "info", "notice", "warn", "error", "critical", "fatal", "fatal"}
+		if num < 0 || num/100 >= len(names) {
+			return "unknown"
+		}
+		return names[num/100]
+	},
+}
+
+func findLevelDef(name string) (levelDef, bool) {
+	for _, def := range canonicalLevels {
+		if def.name == name {
+			return def, true
+		}
+	}
+	return levelDef{}, false
+}
+
+// canonicalLevel resolves name to a level enabled in the current profile,
+// following fallbacks for opt-in levels that are switched off.
+func canonicalLevel(name string) (string, int) {
+	profile := currentProfile()
+	for {
+		def, ok := findLevelDef(name)
+		if !ok {
+			return "unknown", 0
+		}
+		if def.fallback == "" || profile.extraLevels[def.name] {
+			return def.name, def.num
+		}
+		name = def.fallback
+	}
+}
+
+// levelOnScale maps num with a fixed scale, for inputs whose protocol defines
+// what their numeric severities mean regardless of --level-scale.
+func levelOnScale(scale string, num int) (string, int) {
+	name := levelScales[scale](num)
+	if name == "unknown" {
+		return "unknown", 0
+	}
+	return canonicalLevel(name)
+}
+
+// enabledLevels returns the canonical levels in severity order, as shown on
+// the UI's level slider.
+func enabledLevels() []levelDef {
+	profile := currentProfile()
+	levels := make([]levelDef, 0, len(canonicalLevels))
+	for _, def := range canonicalLevels {
+		if def.fallback == "" || profile.extraLevels[def.name] {
+			levels = append(levels, def)
+		}
+	}
+	return levels
+}
+
+// parseLevelMap turns "name=level" pairs into a lookup of lower-cased
+// names to canonical levels.
+func parseLevelMap(pairs []string) (map[string]string, error) {
+	mapping := map[string]string{}
+	for _, pair := range pairs {
+		name, level, ok := strings.Cut(pair, "=")
+		name = strings.ToLower(strings.TrimSpace(name))
+		level = strings.ToLower(strings.TrimSpace(level))
+		if !ok || name == "" || level == "" {
+			return nil, fmt.Errorf("%q: expected name=level", pair)
+		}
+		if _, known := findLevelDef(level); !known && level != "unknown" {
+			return nil, fmt.Errorf("%q: unknown level %q", pair, level)
+		}
+		mapping[name] = level
+	}
+	return mapping, nil
+}
+
+func parseExtraLevels(values []string) (map[string]bool, error) {
+	extra := map[string]bool{}
+	for _, value := range values {
+		for _, name := range strings.Split(value, ",") {
+			name = strings.ToLower(strings.TrimSpace(name))
+			if name == "" {
+				continue
+			}
+			def, ok := findLevelDef(name)
+			if !ok || def.fallback == "" {
+				return nil, fmt.Errorf("%q is not an optional level (available: %s)", name, strings.Join(optionalLevelNames(), ", "))
+			}
+			extra[name] = true
+		}
+	}
+	return extra, nil
+}
+
+func optionalLevelNames() []string {
+	var names []string
+	for _, def := range canonicalLevels {
+		if def.fallback != "" {
+			names = append(names, def.name)
+		}
+	}
+	return names
+}
+
+func levelScaleNames() []string {
+	names := make([]string, 0, len(levelScales))
+	for name := range levelScales {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
@@ -0,0 +1,234 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// lokiChannelLabels are tried in order for the channel of entries pushed
+// without one of the configured channel keys.
+var lokiChannelLabels = []string{"service_name", "app", "job", "container", "namespace"}
+
+type lokiStream struct {
+	labels  map[string]interface{}
+	entries []lokiEntry
+}
+
+type lokiEntry struct {
+	at       time.Time
+	line     string
+	metadata map[string]interface{}
+}
+
+// serveLokiPush implements Loki's /loki/api/v1/push for JSON bodies and
+// snappy-compressed protobuf bodies, so Promtail, Grafana Agent and Loki
+// clients can push to zlog.
+func serveLokiPush(pipeline *Pipeline) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodPost {
+			http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+			return
+		}
+		body, err := readIngestBody(w, r)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		var streams []lokiStream
+		if isProtobufRequest(r) {
+			streams, err = decodeLokiProto(body)
+		} else {
+			streams, err = decodeLokiJSON(body)
+		}
+		if err != nil {
+			http.Error(w, fmt.Sprintf("invalid push request: %v", err), http.StatusBadRequest)
+			return
+		}
+		for _, stream := range streams {
+			for _, item := range stream.entries {
+				pipeline.Ingest(entryFromLoki(stream.labels, item))
+			}
+		}
+		w.WriteHeader(http.StatusNoContent)
+	}
+}
+
+// entryFromLoki adds the stream labels and structured metadata to the pushed
+// line; metadata wins over labels of the same name.
+func entryFromLoki(labels map[string]interface{}, item lokiEntry) LogEntry {
+	meta := make(map[string]interface{}, len(labels)+len(item.metadata))
+	for key, value := range labels {
+		meta[key] = value
+	}
+	for key, value := range item.metadata {
+		meta[key] = value
+	}
+	return entryFromPushedLine(item.line, meta, item.at, lokiChannelLabels)
+}
+
+func decodeLokiJSON(body []byte) ([]lokiStream, error) {
+	var request struct {
+		Streams []struct {
+			Stream map[string]string   `json:"stream"`
+			Values [][]json.RawMessage `json:"values"`
+		} `json:"streams"`
+	}
+	if err := json.Unmarshal(body, &request); err != nil {
+		return nil, err
+	}
+	streams := make([]lokiStream, 0, len(request.Streams))
+	for _, raw := range request.Streams {
+		stream := lokiStream{labels: make(map[string]interface{}, len(raw.Stream))}
+		for key, value := range raw.Stream {
+			stream.labels[key] = value
+		}
+		for _, value := range raw.Values {
+			if len(value) < 2 {
+				return nil, fmt.Errorf("stream value needs a timestamp and a line")
+			}
+			var ts, line string
+			if err := json.Unmarshal(value[0], &ts); err != nil {
+				return nil, fmt.Errorf("timestamp: %w", err)
+			}
+			if err := json.Unmarshal(value[1], &line); err != nil {
+				return nil, fmt.Errorf("line: %w", err)
+			}
+			nanos, err := strconv.ParseInt(ts, 10, 64)
+			if err != nil {
+				return nil, fmt.Errorf("timestamp %q is not unix nanoseconds", ts)
+			}
+			item := lokiEntry{at: time.Unix(0, nanos), line: line}
+			if len(value) > 2 {
+				var metadata map[string]string
+				if err := json.Unmarshal(value[2], &metadata); err != nil {
+					return nil, fmt.Errorf("structured metadata: %w", err)
+				}
+				item.metadata = make(map[string]interface{}, len(metadata))
+				for key, v := range metadata {
+					item.metadata[key] = v
+				}
+			}
+			stream.entries = append(stream.entries, item)
+		}
+		streams = append(streams, stream)
+	}
+	return streams, nil
+}
+
+// decodeLokiProto decodes a snappy-compressed logproto.PushRequest.
+func decodeLokiProto(body []byte) ([]lokiStream, error) {
+	decoded, err := decodeSnappy(body)
+	if err != nil {
+		return nil, err
+	}
+	var streams []lokiStream
+	err = walkProto(decoded, func(f protoField) error {
+		if f.number != 1 || f.wire != wireBytes {
+			return nil
+		}
+		var stream lokiStream
+		err := walkProto(f.data, func(sf protoField) error {
+			if sf.wire != wireBytes {
+				return nil
+			}
+			switch sf.number {
+			case 1:
+				labels, err := parseLokiLabels(string(sf.data))
+				stream.labels = labels
+				return err
+			case 2:
+				item, err := decodeLokiProtoEntry(sf.data)
+				stream.entries = append(stream.entries, item)
+				return err
+			}
+			return nil
+		})
+		streams = append(streams, stream)
+		return err
+	})
+	return streams, err
+}
+
+func decodeLokiProtoEntry(buf []byte) (lokiEntry, error) {
+	var item lokiEntry
+	var seconds, nanos int64
+	err := walkProto(buf, func(f protoField) error {
+		switch f.number {
+		case 1:
+			return walkProto(f.data, func(tf protoField) error {
+				switch tf.number {
+				case 1:
+					seconds = int64(tf.num)
+				case 2:
+					nanos = int64(int32(tf.num))
+				}
+				return nil
+			})
+		case 2:
+			item.line = string(f.data)
+		case 3:
+			var name, value string
+			err := walkProto(f.data, func(mf protoField) error {
+				switch mf.number {
+				case 1:
+					name = string(mf.data)
+				case 2:
+					value = string(mf.data)
+				}
+				return nil
+			})
+			if item.metadata == nil {
+				item.metadata = map[string]interface{}{}
+			}
+			item.metadata[name] = value
+			return err
+		}
+		return nil
+	})
+	item.at = time.Unix(seconds, nanos)
+	return item, err
+}
+
+// parseLokiLabels parses a label set such as {job="api", env="dev"}.
+func parseLokiLabels(raw string) (map[string]interface{}, error) {
+	labels := map[string]interface{}{}
+	s := strings.TrimSpace(raw)
+	if !strings.HasPrefix(s, "{") || !strings.HasSuffix(s, "}") {
+		return nil, fmt.Errorf("labels %q are not a {name=\"value\"} set", raw)
+	}
+	s = strings.TrimSpace(s[1 : len(s)-1])
+	for s != "" {
+		eq := strings.IndexByte(s, '=')
+		if eq <= 0 {
+			return nil, fmt.Errorf("labels %q: expected name=\"value\"", raw)
+		}
+		name := strings.TrimSpace(s[:eq])
+		s = strings.TrimSpace(s[eq+1:])
+		if !strings.HasPrefix(s, `"`) {
+			return nil, fmt.Errorf("labels %q: value of %s is not quoted", raw, name)
+		}
+		end := 1
+		for end < len(s) && s[end] != '"' {
+			if s[end] == '\\' {
+				end++
+			}
+			end++
+		}
+		if end >= len(s) {
+			return nil, fmt.Errorf("labels %q: unterminated value", raw)
+		}
+		value, err := strconv.Unquote(s[:end+1])
+		if err != nil {
+			return nil, fmt.Errorf("labels %q: %w", raw, err)
+		}
+		labels[name] = value
+		s = strings.TrimSpace(s[end+1:])
+		s = strings.TrimPrefix(s, ",")
+		s = strings.TrimSpace(s)
+	}
+	return labels, nil
+}
@@ -9,6 +9,7 @@ import (
 	"io"
 	"io/fs"
 	"log"
+	"math"
 	"net"
 	"net/http"
 	"os"
@@ -27,6 +28,7 @@ const (
 type LogEntry struct {
 	ID         int64                  `json:"id"`
 	Time       string                 `json:"time,omitempty"`
+	At         time.Time              `json:"-"`
 	Ingested   string                 `json:"ingested"`
 	SentMs     int64                  `json:"sentMs,omitempty"`
 	Level      string                 `json:"level"`
@@ -34,6 +36,10 @@ type LogEntry struct {
 	Msg        string                 `json:"msg"`
 	Raw        string                 `json:"raw"`
 	Fields     map[string]interface{} `json:"fields,omitempty"`
+	Channel    interface{}            `json:"channel,omitempty"`
+	MsgSpans   []ansiSpan             `json:"msgSpans,omitempty"`
+	Source     string                 `json:"source,omitempty"`
+	Via        []string               `json:"-"`
 	ParseError string                 `json:"parseError,omitempty"`
 }
 
@@ -48,6 +54,10 @@ func (s *stringList) Set(value string) error {
 	return nil
 }
 
+func (s *stringList) Get() interface{} {
+	return []string(*s)
+}
+
 type LogStore struct {
 	mu      sync.Mutex
 	entries []LogEntry
@@ -92,6 +102,30 @@ func (s *LogStore) List() []LogEntry {
 	return out
 }
 
+// Sources counts the stored entries by source, in order of first appearance.
+func (s *LogStore) Sources() []sourceCount {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	counts := []sourceCount{}
+	index := map[string]int{}
+	for _, entry := range s.entries {
+		i, ok := index[entry.Source]
+		if !ok {
+			i = len(counts)
+			index[entry.Source] = i
+			counts = append(counts, sourceCount{Name: entry.Source})
+		}
+		counts[i].Count++
+	}
+	return counts
+}
+
+type sourceCount struct {
+	Name  string `json:"name"`
+	Count int    `json:"count"`
+}
+
 func (s *LogStore) Max() int {
 	s.mu.Lock()
 	defer s.mu.Unlock()
@@ -147,6 +181,82 @@ func (h *Hub) Broadcast(msg string) {
 	h.broadcast <- msg
 }
 
+type Pipeline struct {
+	store         *LogStore
+	hub           *Hub
+	filters       []filterExpression
+	includeSentMs bool
+	source        string
+	reorder       *reorderBuffer
+	sinks         []entrySink
+}
+
+// entrySink receives every entry the pipeline stores. Write must not block.
+type entrySink interface {
+	Write(entry LogEntry)
+}
+
+func NewPipeline(store *LogStore, hub *Hub, filters []filterExpression, includeSentMs bool) *Pipeline {
+	return &Pipeline{
+		store:         store,
+		hub:           hub,
+		filters:       filters,
+		includeSentMs: includeSentMs,
+	}
+}
+
+// WithSource returns a pipeline that tags the entries it ingests with source,
+// for inputs that serve several writers.
+func (p *Pipeline) WithSource(source string) *Pipeline {
+	tagged := *p
+	tagged.source = source
+	return &tagged
+}
+
+func (p *Pipeline) Ingest(entry LogEntry) bool {
+	if entry.Source == "" {
+		entry.Source = p.source
+	}
+	if !passesFilterExpressions(entry, p.filters) {
+		return false
+	}
+	if p.reorder != nil {
+		p.reorder.Push(entry)
+		return true
+	}
+	p.emit(entry)
+	return true
+}
+
+// EnableReorder holds entries for window and stores them sorted by time. It
+// must be called before any input starts.
+func (p *Pipeline) EnableReorder(window time.Duration) {
+	if window > 0 {
+		p.reorder = newReorderBuffer(window, p.emit)
+	}
+}
+
+// AddSink passes stored entries on to sink. It must be called before any
+// input starts.
+func (p *Pipeline) AddSink(sink entrySink) {
+	p.sinks = append(p.sinks, sink)
+}
+
+func (p *Pipeline) emit(entry LogEntry) {
+	entry = p.store.Add(entry)
+	for _, sink := range p.sinks {
+		sink.Write(entry)
+	}
+	if p.includeSentMs {
+		entry.SentMs = time.Now().UnixMilli()
+	}
+	payload, err := json.Marshal(entry)
+	if err != nil {
+		return
+	}
+	p.hub.Broadcast(string(payload))
+}
+
 //go:embed web/*
 var webFS embed.FS
 
@@ -159,13 +269,83 @@ func main() {
 	debugLatency := flag.Bool("debug-latency", false, "Include sentMs in SSE payloads")
 	var filters stringList
 	var channels stringList
+	var msgKeyFlags, levelKeyFlags, timeKeyFlags, channelKeyFlags stringList
 	flag.Var(&filters, "filter", "Filter expression (repeatable)")
 	flag.Var(&channels, "channel", "Channel filter shorthand (repeatable)")
+	flag.Var(&msgKeyFlags, "msg-key", "Field path holding the message, tried in order (repeatable)")
+	flag.Var(&levelKeyFlags, "level-key", "Field path holding the level, tried in order (repeatable)")
+	flag.Var(&timeKeyFlags, "time-key", "Field path holding the timestamp, tried in order (repeatable)")
+	flag.Var(&channelKeyFlags, "channel-key", "Field path holding the channel, tried in order (repeatable)")
+	preset := flag.String("preset", "", "Logger format preset, or auto to detect it from the first entries")
+	var levelMapFlags, extraLevelFlags stringList
+	flag.Var(&levelMapFlags, "level-map", "Map a level name or number to a level, as name=level (repeatable)")
+	flag.Var(&extraLevelFlags, "extra-levels", "Enable optional levels such as notice,critical (repeatable)")
+	decodeJSON := flag.Bool("decode-json", false, "Decode JSON objects and arrays found inside string fields")
+	var decodeJSONPathFlags stringList
+	flag.Var(&decodeJSONPathFlags, "decode-json-path", "Field path whose string value holds JSON to decode (repeatable)")
+	inputFormat := flag.String("format", "", "Input format: csv or tsv with a header row, or journal for journalctl -o export (default one JSON or text entry per line)")
+	ansiMode := flag.String("ansi", "strip", "ANSI escape codes in lines: strip, spans (strip and keep message colors) or keep")
+	var patternFlags stringList
+	flag.Var(&patternFlags, "pattern", "Named-capture regex or built-in pattern (nginx, apache-combined, klog, python, rails) for plain lines (repeatable)")
+	var timeLayoutFlags stringList
+	flag.Var(&timeLayoutFlags, "time-layout", "Extra Go time layout to try first, e.g. \"02.01.2006 15:04:05\" (repeatable)")
+	displayTZ := flag.String("tz", "Local", "Time zone for displayed timestamps: UTC, Local or an IANA name")
+	sourceTZ := flag.String("source-tz", "UTC", "Time zone assumed for timestamps that carry no offset")
+	levelScale := flag.String("level-scale", "", "Scale for numeric levels: pino, syslog, otel, dotnet or gcp (default pino)")
+	gelfAddr := flag.String("gelf", "", "Listen for GELF messages on this address over UDP and TCP, e.g. :12201")
+	fluentAddr := flag.String("fluentd", "", "Listen for the Fluent Forward protocol on this address, e.g. :24224")
+	unixPath := flag.String("listen-unix", "", "Read lines from connections to this Unix stream socket, e.g. /tmp/zlog.sock")
+	unixgramPath := flag.String("listen-unixgram", "", "Read lines from datagrams sent to this Unix datagram socket")
+	reorderWindow := flag.Duration("reorder", 0, "Hold entries this long and emit them sorted by their own time, e.g. 2s (default off)")
+	forwardURL := flag.String("forward", "", "Also send stored entries to another zlog, e.g. http://central:8037")
+	forwardHost := flag.String("forward-host", "", "Host label added to forwarded entries (default the hostname)")
+	forwardBuffer := flag.Int("forward-buffer", 100000, "Entries kept for --forward while the remote is unreachable")
+	var outputFlags stringList
+	flag.Var(&outputFlags, "output", "Also write stored entries to a rotating file, e.g. file:///var/log/zlog/app.jsonl?max-size=50MB&keep=7 (repeatable)")
+	alertsPath := flag.String("alerts", "", "JSON file with webhook alert rules (see README)")
+	fifoPath := flag.String("fifo", "", "Read lines from this named pipe, created if missing and reopened for each writer")
+	configPath := flag.String("config", "", "Config file (JSON, or TOML/YAML subset) with defaults for these flags")
 	flag.Usage = func() {
 		printUsage(flag.CommandLine.Output(), os.Args[0])
 	}
 	flag.Parse()
 
+	if *configPath == "" {
+		*configPath = findDefaultConfig()
+	}
+	if *configPath != "" {
+		values, err := loadConfigFile(*configPath)
+		if err != nil {
+			log.Fatalf("config: %v", err)
+		}
+		if err := applyConfig(flag.CommandLine, values); err != nil {
+			log.Fatalf("config %s: %v", *configPath, err)
+		}
+	}
+
+	profile, err := buildParseProfile(profileSettings{
+		preset:      *preset,
+		messageKeys: msgKeyFlags,
+		levelKeys:   levelKeyFlags,
+		timeKeys:    timeKeyFlags,
+		channelKeys: channelKeyFlags,
+		levelMap:    levelMapFlags,
+		levelScale:  *levelScale,
+		extraLevels: extraLevelFlags,
+		timeLayouts: timeLayoutFlags,
+		patterns:    patternFlags,
+		decodeJSON:  *decodeJSON,
+		decodePaths: decodeJSONPathFlags,
+		ansi:        *ansiMode,
+		format:      *inputFormat,
+		displayTZ:   *displayTZ,
+		sourceTZ:    *sourceTZ,
+	})
+	if err != nil {
+		log.Fatalf("%v", err)
+	}
+	activeProfile.Store(profile)
+
 	initialFilters := buildInitialFilters(filters, channels)
 	filterExpressions, err := parseFilterExpressions(initialFilters)
 	if err != nil {
@@ -174,22 +354,121 @@ func main() {
 	store := NewLogStore(*maxEntries)
 	hub := NewHub()
 	go hub.Run()
+	pipeline := NewPipeline(store, hub, filterExpressions, *debugLatency)
+	pipeline.EnableReorder(*reorderWindow)
+	if *forwardURL != "" {
+		label := *forwardHost
+		if label == "" {
+			label, _ = os.Hostname()
+		}
+		sink, err := newForwarder(*forwardURL, label, *forwardBuffer, net.JoinHostPort(*host, strconv.Itoa(*port)))
+		if err != nil {
+			log.Fatalf("forward: %v", err)
+		}
+		pipeline.AddSink(sink)
+	}
+	alerts := newAlertManager(pipeline)
+	if *alertsPath != "" {
+		specs, err := loadAlertRules(*alertsPath)
+		if err != nil {
+			log.Fatalf("alerts: %v", err)
+		}
+		for _, spec := range specs {
+			if err := alerts.Put(spec); err != nil {
+				log.Fatalf("alerts: %v", err)
+			}
+		}
+	}
+	pipeline.AddSink(alerts)
+	for _, spec := range outputFlags {
+		sink, err := newFileSink(spec)
+		if err != nil {
+			log.Fatalf("output: %v", err)
+		}
+		pipeline.AddSink(sink)
+	}
 
-	go func() {
-		if err := readStdin(store, hub, *debugLatency, filterExpressions); err != nil {
-			log.Printf("stdin read error: %v", err)
+	if *gelfAddr != "" {
+		if err := listenGELF(*gelfAddr, pipeline.WithSource("gelf")); err != nil {
+			log.Fatalf("gelf: %v", err)
+		}
+	}
+	if *fluentAddr != "" {
+		if err := listenFluentForward(*fluentAddr, pipeline.WithSource("fluentd")); err != nil {
+			log.Fatalf("fluentd: %v", err)
+		}
+	}
+	if *unixPath != "" {
+		if err := listenUnix(*unixPath, pipeline); err != nil {
+			log.Fatalf("listen-unix: %v", err)
 		}
-	}()
+	}
+	if *unixgramPath != "" {
+		if err := listenUnixgram(*unixgramPath, pipeline); err != nil {
+			log.Fatalf("listen-unixgram: %v", err)
+		}
+	}
+	if *fifoPath != "" {
+		if err := readFIFO(*fifoPath, pipeline); err != nil {
+			log.Fatalf("fifo: %v", err)
+		}
+	}
+
+	var replayer *Replayer
+	if args := flag.Args(); len(args) > 0 && args[0] == "replay" {
+		replayer, err = newReplayerFromArgs(pipeline.WithSource("replay"), args[1:])
+		if err != nil {
+			log.Fatalf("replay: %v", err)
+		}
+		go replayer.Run()
+	} else if args := flag.Args(); len(args) > 0 {
+		go func() {
+			if err := readFiles(pipeline, args); err != nil {
+				log.Printf("read error: %v", err)
+			}
+		}()
+	} else {
+		go func() {
+			if err := readStdin(pipeline); err != nil {
+				log.Printf("stdin read error: %v", err)
+			}
+		}()
+	}
 
 	sub, err := fs.Sub(webFS, "web")
 	if err != nil {
 		log.Fatalf("failed to load web assets: %v", err)
 	}
 
+	elastic := pipeline.WithSource("elasticsearch")
+	splunk := pipeline.WithSource("splunk")
 	mux := http.NewServeMux()
 	mux.HandleFunc("/events", serveEvents(hub))
 	mux.HandleFunc("/logs", serveLogs(store))
-	mux.HandleFunc("/config", serveConfig(store, initialFilters))
+	mux.HandleFunc("/sources", serveSources(store))
+	mux.HandleFunc("/config", serveConfig(store, initialFilters, effectiveOptions(flag.CommandLine)))
+	mux.HandleFunc("/alerts", serveAlerts(alerts))
+	mux.HandleFunc("/alerts/rules", serveAlertRules(alerts))
+	mux.HandleFunc("/alerts/rules/", serveAlertRules(alerts))
+	mux.HandleFunc("/ingest", serveIngest(pipeline.WithSource("forward")))
+	mux.HandleFunc("/v1/logs", serveOTLPLogs(pipeline.WithSource("otlp")))
+	mux.HandleFunc("/loki/api/v1/push", serveLokiPush(pipeline.WithSource("loki")))
+	mux.HandleFunc("/_bulk", serveElastic(elastic))
+	mux.HandleFunc("/es/", serveElastic(elastic))
+	for _, path := range []string{"/services/collector", "/services/collector/event", "/services/collector/event/1.0"} {
+		mux.HandleFunc(path, serveSplunkEvent(splunk))
+	}
+	mux.HandleFunc("/services/collector/raw", serveSplunkRaw(splunk))
+	mux.HandleFunc("/services/collector/raw/1.0", serveSplunkRaw(splunk))
+	mux.HandleFunc("/services/collector/health", serveSplunkHealth)
+	mux.HandleFunc("/services/collector/health/1.0", serveSplunkHealth)
+	if replayer != nil {
+		mux.HandleFunc("/replay", serveReplayStatus(replayer))
+		mux.HandleFunc("/replay/pause", serveReplayControl(replayer, (*Replayer).Pause))
+		mux.HandleFunc("/replay/resume", serveReplayControl(replayer, (*Replayer).Resume))
+		mux.HandleFunc("/replay/seek", serveReplaySeek(replayer))
+		mux.HandleFunc("/replay/speed", serveReplaySpeed(replayer))
+	}
 	mux.HandleFunc("/healthz", func(w http.ResponseWriter, _ *http.Request) {
 		w.WriteHeader(http.StatusOK)
 		_, _ = w.Write([]byte("ok"))
@@ -207,41 +486,88 @@ func main() {
 	}
 }
 
-func readStdin(store *LogStore, hub *Hub, includeSentMs bool, filters []filterExpression) error {
-	scanner := bufio.NewScanner(os.Stdin)
-	buf := make([]byte, 0, 64*1024)
-	scanner.Buffer(buf, maxScanTokenSize)
+func readStdin(pipeline *Pipeline) error {
+	return readLines(pipeline.WithSource("stdin"), os.Stdin)
+}
 
-	for scanner.Scan() {
-		line := strings.TrimRight(scanner.Text(), "\r")
-		var entry LogEntry
-		if strings.TrimSpace(line) == "" {
-			entry = LogEntry{
-				Raw:      line,
-				Ingested: formatTime(time.Now()),
-				Level:    "plain",
-				Msg:      "",
+// readFiles ingests each file in turn; "-" reads stdin.
+func readFiles(pipeline *Pipeline, paths []string) error {
+	for _, path := range paths {
+		if path == "-" {
+			if err := readStdin(pipeline); err != nil {
+				return fmt.Errorf("stdin: %w", err)
 			}
-		} else {
-			entry = parseLine(line)
-		}
-		if !passesFilterExpressions(entry, filters) {
 			continue
 		}
-		entry = store.Add(entry)
-		if includeSentMs {
-			entry.SentMs = time.Now().UnixMilli()
+		file, err := os.Open(path)
+		if err != nil {
+			return err
 		}
-		payload, err := json.Marshal(entry)
+		err = readLines(pipeline.WithSource(path), file)
+		file.Close()
 		if err != nil {
-			continue
+			return fmt.Errorf("%s: %w", path, err)
 		}
-		hub.Broadcast(string(payload))
 	}
+	return nil
+}
 
+// readLines ingests r line by line, decompressing it first if needed.
+func readLines(pipeline *Pipeline, r io.Reader) error {
+	input, err := decompressReader(r)
+	if err != nil {
+		return err
+	}
+	defer input.Close()
+	buffered := bufio.NewReader(input)
+	format := currentProfile().format
+	if format == formatLines && startsLikeJournalExport(buffered) {
+		format = formatJournal
+	}
+	switch format {
+	case formatCSV:
+		return readDelimited(pipeline, buffered, ',')
+	case formatTSV:
+		return readDelimited(pipeline, buffered, '\t')
+	case formatJournal:
+		return readJournalExport(pipeline, buffered)
+	}
+	scanner := newLineScanner(buffered)
+	assembler := newLineAssembler()
+	for scanner.Scan() {
+		if line, ok := assembler.Push(scanner.Text()); ok {
+			pipeline.Ingest(entryFromLine(line))
+		}
+	}
+	for _, line := range assembler.Flush() {
+		pipeline.Ingest(entryFromLine(line))
+	}
 	return scanner.Err()
 }
 
+func newLineScanner(r io.Reader) *bufio.Scanner {
+	scanner := bufio.NewScanner(r)
+	buf := make([]byte, 0, 64*1024)
+	scanner.Buffer(buf, maxScanTokenSize)
+	return scanner
+}
+
+func entryFromLine(text string) LogEntry {
+	line := strings.TrimRight(text, "\r")
+	if strings.TrimSpace(line) == "" {
+		return LogEntry{
+			Raw:      line,
+			Ingested: formatTime(time.Now()),
+			Level:    "plain",
+			Msg:      "",
+		}
+	}
+	if mode := currentProfile().ansiMode; mode != ansiKeep {
+		return applyANSI(line, mode)
+	}
+	return parseLine(line)
+}
+
 func serveEvents(hub *Hub) http.HandlerFunc {
 	return func(w http.ResponseWriter, r *http.Request) {
 		flusher, ok := w.(http.Flusher)
@@ -292,15 +618,36 @@ func serveLogs(store *LogStore) http.HandlerFunc {
 	}
 }
 
-func serveConfig(store *LogStore, initialFilters []string) http.HandlerFunc {
+func serveSources(store *LogStore) http.HandlerFunc {
+	return func(w http.ResponseWriter, _ *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		_ = json.NewEncoder(w).Encode(store.Sources())
+	}
+}
+
+func serveConfig(store *LogStore, initialFilters []string, options map[string]interface{}) http.HandlerFunc {
 	return func(w http.ResponseWriter, _ *http.Request) {
 		w.Header().Set("Content-Type", "application/json")
+		type levelInfo struct {
+			Name string `json:"name"`
+			Num  int    `json:"num"`
+		}
+		levels := []levelInfo{}
+		for _, def := range enabledLevels() {
+			levels = append(levels, levelInfo{Name: def.name, Num: def.num})
+		}
 		response := struct {
-			MaxEntries int      `json:"maxEntries"`
-			Filters    []string `json:"filters,omitempty"`
+			MaxEntries int                    `json:"maxEntries"`
+			Filters    []string               `json:"filters,omitempty"`
+			Levels     []levelInfo            `json:"levels"`
+			TimeZone   string                 `json:"timeZone,omitempty"`
+			Options    map[string]interface{} `json:"options"`
 		}{
 			MaxEntries: store.Max(),
 			Filters:    nilIfEmpty(initialFilters),
+			Levels:     levels,
+			TimeZone:   displayZoneName(),
+			Options:    options,
 		}
 		_ = json.NewEncoder(w).Encode(response)
 	}
@@ -314,33 +661,82 @@ func parseLine(line string) LogEntry {
 	}
 
 	var payload map[string]interface{}
+	var prefixFields map[string]interface{}
 	if err := json.Unmarshal([]byte(line), &payload); err != nil {
-		entry.Level = "plain"
-		entry.Msg = line
-		entry.ParseError = err.Error()
-		return entry
+		if content, meta, ok := unwrapCRILine(line); ok {
+			return parseEnveloped(line, content, meta)
+		}
+		prefix, embedded, ok := splitJSONPrefix(line)
+		if !ok {
+			parsePlainLine(&entry, err)
+			return entry
+		}
+		payload = embedded
+		prefixFields = parseLinePrefix(prefix)
+		applyPrefixFields(payload, prefixFields)
+	} else if isJournalEntry(payload) {
+		return entryFromJournal(line, payload)
+	} else if content, meta, ok := unwrapEnvelope(payload); ok {
+		return parseEnveloped(line, content, meta)
+	}
+
+	profile := currentProfile()
+	if profile.detector != nil {
+		profile = profile.detector.observe(payload)
 	}
+	applyFields(&entry, payload, profile)
+	return entry
+}
+
+func parsePlainLine(entry *LogEntry, parseErr error) {
+	if fields, ok := matchLinePatterns(entry.Raw, currentProfile().patterns); ok {
+		applyPatternFields(entry, fields)
+		return
+	}
+	entry.Level = "plain"
+	entry.Msg = entry.Raw
+	entry.ParseError = parseErr.Error()
+	if t, ok := extractLeadingTime(entry.Raw); ok {
+		entry.At = t
+		entry.Time = formatTime(t)
+	}
+}
 
-	entry.Fields = payload
-	entry.Msg = pickString(payload, "msg", "message", "event", "error", "err")
-	level, levelNum := extractLevel(payload)
+// applyFields fills in the message, level, time and channel of an entry from
+// its structured fields.
+func applyFields(entry *LogEntry, fields map[string]interface{}, profile *parseProfile) {
+	if profile.decodeJSON || len(profile.decodeJSONPaths) > 0 {
+		decodeEmbeddedJSON(fields, profile.decodeJSON, profile.decodeJSONPaths, profile.messageKeys)
+	}
+	entry.Fields = fields
+	entry.Msg = pickString(fields, profile.messageKeys)
+	level, levelNum := extractLevel(fields)
 	entry.Level = level
 	entry.LevelNum = levelNum
-	entry.Time = extractTime(payload)
+	if t, ok := extractTimeValue(fields); ok {
+		entry.At = t
+		entry.Time = formatTime(t)
+	} else {
+		entry.Time = extractTime(fields)
+	}
+	if channel, ok := extractChannel(fields); ok {
+		entry.Channel = channel
+	}
 
 	if entry.Msg == "" {
-		entry.Msg = line
+		entry.Msg = entry.Raw
+	}
+	if entry.Level == "" && profile.defaultLevel != "" {
+		entry.Level, entry.LevelNum = levelFromString(profile.defaultLevel)
 	}
 	if entry.Level == "" {
 		entry.Level = "unknown"
 	}
-
-	return entry
 }
 
-func pickString(fields map[string]interface{}, keys ...string) string {
-	for _, key := range keys {
-		val, ok := fields[key]
+func pickString(fields map[string]interface{}, paths []fieldPath) string {
+	for _, path := range paths {
+		val, ok := lookupField(fields, path)
 		if !ok || val == nil {
 			continue
 		}
@@ -357,15 +753,23 @@ func pickString(fields map[string]interface{}, keys ...string) string {
 }
 
 func extractLevel(fields map[string]interface{}) (string, int) {
-	keys := []string{"level", "severity", "lvl", "level_name"}
-	for _, key := range keys {
-		if val, ok := fields[key]; ok {
+	for _, path := range currentProfile().levelKeys {
+		if val, ok := lookupField(fields, path); ok {
 			return normalizeLevel(val)
 		}
 	}
 	return "", 0
 }
 
+func extractChannel(fields map[string]interface{}) (interface{}, bool) {
+	for _, path := range currentProfile().channelKeys {
+		if val, ok := lookupField(fields, path); ok && val != nil {
+			return val, true
+		}
+	}
+	return nil, false
+}
+
 func normalizeLevel(val interface{}) (string, int) {
 	switch v := val.(type) {
 	case float64:
@@ -377,23 +781,27 @@ func normalizeLevel(val interface{}) (string, int) {
 	}
 }
 
+// levelFromNumber applies --level-map to the number first, so a mapping such
+// as 30=error holds for numeric JSON levels as well as quoted ones.
 func levelFromNumber(num int) (string, int) {
-	switch {
-	case num >= 60:
-		return "fatal", num
-	case num >= 50:
-		return "error", num
-	case num >= 40:
-		return "warn", num
-	case num >= 30:
-		return "info", num
-	case num >= 20:
-		return "debug", num
-	case num >= 10:
-		return "trace", num
-	default:
+	if mapped, ok := currentProfile().levelNames[strconv.Itoa(num)]; ok {
+		return canonicalLevel(mapped)
+	}
+	scale := currentProfile().levelScale
+	if scale == "" {
+		scale = "pino"
+	}
+	name := levelScales[scale](num)
+	if name == "unknown" {
 		return "unknown", num
 	}
+	level, levelNum := canonicalLevel(name)
+	if scale == "pino" {
+		// pino and bunyan numbers already sit on the canonical scale, so
+		// keep in-between values such as 35 as they were logged.
+		levelNum = num
+	}
+	return level, levelNum
 }
 
 func levelFromString(raw string) (string, int) {
@@ -401,6 +809,9 @@ func levelFromString(raw string) (string, int) {
 	if s == "" {
 		return "unknown", 0
 	}
+	if mapped, ok := currentProfile().levelNames[s]; ok {
+		return canonicalLevel(mapped)
+	}
 	if num, err := strconv.Atoi(s); err == nil {
 		return levelFromNumber(num)
 	}
@@ -410,23 +821,33 @@ func levelFromString(raw string) (string, int) {
 		return "trace", 10
 	case "debug", "dbg":
 		return "debug", 20
-	case "info", "information", "notice":
+	case "info", "information":
 		return "info", 30
+	case "notice":
+		return canonicalLevel("notice")
 	case "warn", "warning":
 		return "warn", 40
 	case "error", "err":
 		return "error", 50
-	case "fatal", "panic", "critical", "crit":
+	case "critical", "crit":
+		return canonicalLevel("critical")
+	case "fatal", "panic", "alert", "emerg", "emergency":
 		return "fatal", 60
 	default:
+		// slog renders in-between levels as an offset from a named one,
+		// e.g. "INFO+2" or "DEBUG-4".
+		if i := strings.LastIndexAny(s, "+-"); i > 0 {
+			if _, err := strconv.Atoi(s[i+1:]); err == nil {
+				return levelFromString(s[:i])
+			}
+		}
 		return "unknown", 0
 	}
 }
 
 func extractTime(fields map[string]interface{}) string {
-	keys := []string{"time", "timestamp", "ts", "@timestamp"}
-	for _, key := range keys {
-		if val, ok := fields[key]; ok {
+	for _, path := range currentProfile().timeKeys {
+		if val, ok := lookupField(fields, path); ok {
 			if rendered := formatTimeValue(val); rendered != "" {
 				return rendered
 			}
@@ -435,24 +856,42 @@ func extractTime(fields map[string]interface{}) string {
 	return ""
 }
 
+// extractTimeValue is like extractTime but returns the parsed instant, for
+// callers that need to order or space entries rather than display them.
+func extractTimeValue(fields map[string]interface{}) (time.Time, bool) {
+	for _, path := range currentProfile().timeKeys {
+		if val, ok := lookupField(fields, path); ok {
+			if t, ok := parseTimeValue(val); ok {
+				return t, true
+			}
+		}
+	}
+	return time.Time{}, false
+}
+
 func formatTimeValue(val interface{}) string {
+	if t, ok := parseTimeValue(val); ok {
+		return formatTime(t)
+	}
+	if v, ok := val.(string); ok {
+		return v
+	}
+	return ""
+}
+
+func parseTimeValue(val interface{}) (time.Time, bool) {
 	switch v := val.(type) {
 	case float64:
-		if t, ok := timeFromNumber(v); ok {
-			return formatTime(t)
-		}
+		return timeFromNumber(v)
 	case string:
 		if t, ok := parseTimeString(v); ok {
-			return formatTime(t)
+			return t, true
 		}
 		if num, err := strconv.ParseFloat(v, 64); err == nil {
-			if t, ok := timeFromNumber(num); ok {
-				return formatTime(t)
-			}
+			return timeFromNumber(num)
 		}
-		return v
 	}
-	return ""
+	return time.Time{}, false
 }
 
 func timeFromNumber(num float64) (time.Time, bool) {
@@ -467,29 +906,29 @@ func timeFromNumber(num float64) (time.Time, bool) {
 	case num > 1e11:
 		return time.UnixMilli(int64(num)), true
 	case num > 1e9:
-		return time.Unix(int64(num), 0), true
+		// float64 keeps roughly microsecond precision at this magnitude.
+		sec, frac := math.Modf(num)
+		return time.Unix(int64(sec), int64(math.Round(frac*1e6))*1e3), true
 	default:
 		return time.Time{}, false
 	}
 }
 
 func parseTimeString(raw string) (time.Time, bool) {
-	candidates := []string{
-		time.RFC3339Nano,
-		time.RFC3339,
-		"2006-01-02 15:04:05.000",
-		"2006-01-02 15:04:05",
-	}
-	for _, layout := range candidates {
-		if t, err := time.Parse(layout, raw); err == nil {
-			return t, true
+	raw = strings.TrimSpace(raw)
+	profile := currentProfile()
+	for _, layouts := range [][]string{profile.timeLayouts, timeLayoutCatalog} {
+		for _, layout := range layouts {
+			if t, err := time.ParseInLocation(layout, raw, profile.sourceLocation); err == nil {
+				return completeYear(t), true
+			}
 		}
 	}
 	return time.Time{}, false
 }
 
 func formatTime(t time.Time) string {
-	return t.Local().Format("2006-01-02 15:04:05.000")
+	return t.In(currentProfile().displayLocation).Format(displayTimeLayout)
 }
 
 func displayHost(host string) string {
@@ -538,6 +977,8 @@ func printUsage(w io.Writer, name string) {
 		}
 		_, _ = fmt.Fprintf(w, "  --%s %s\n        %s\n", f.Name, valueTypeHint(f), usage)
 	})
+	_, _ = fmt.Fprintf(w, "\nArguments:\n  [file ...]\n        Read these files (gzip, bzip2 or zstd compressed, or - for stdin) instead of stdin\n")
+	_, _ = fmt.Fprintf(w, "\nSubcommands:\n  replay [--speed n] [--start offset] [--paused] <file>\n        Replay a recorded log file with its original timing\n")
 }
 
 func formatDefaultValue(value string) string {
@@ -0,0 +1,210 @@
+package main
+
+import (
+	"bufio"
+	"encoding/binary"
+	"fmt"
+	"io"
+	"math"
+)
+
+// msgpackExt is an extension value, such as Fluentd's EventTime (type 0).
+type msgpackExt struct {
+	kind int8
+	data []byte
+}
+
+// msgpackMaxLength bounds any single string, binary, array or map so a
+// corrupt length prefix cannot exhaust memory.
+const msgpackMaxLength = maxIngestBodySize
+
+// msgpackMaxDepth bounds how deeply arrays and maps may nest, so a peer
+// cannot exhaust the stack with a run of nested array headers.
+const msgpackMaxDepth = 64
+
+// msgpackReader decodes MessagePack values into the types used by JSON
+// decoding: numbers become float64 and maps map[string]interface{}. Binary
+// values stay []byte so PackedForward payloads can be decoded again.
+type msgpackReader struct {
+	r *bufio.Reader
+}
+
+func newMsgpackReader(r io.Reader) *msgpackReader {
+	if buffered, ok := r.(*bufio.Reader); ok {
+		return &msgpackReader{r: buffered}
+	}
+	return &msgpackReader{r: bufio.NewReader(r)}
+}
+
+func (m *msgpackReader) Decode() (interface{}, error) {
+	return m.decode(0)
+}
+
+func (m *msgpackReader) decode(depth int) (interface{}, error) {
+	tag, err := m.r.ReadByte()
+	if err != nil {
+		return nil, err
+	}
+	switch {
+	case tag <= 0x7f:
+		return float64(tag), nil
+	case tag >= 0xe0:
+		return float64(int8(tag)), nil
+	case tag&0xf0 == 0x80:
+		return m.readMap(int(tag&0x0f), depth)
+	case tag&0xf0 == 0x90:
+		return m.readArray(int(tag&0x0f), depth)
+	case tag&0xe0 == 0xa0:
+		data, err := m.readBytes(int(tag & 0x1f))
+		return string(data), err
+	}
+	switch tag {
+	case 0xc0:
+		return nil, nil
+	case 0xc2:
+		return false, nil
+	case 0xc3:
+		return true, nil
+	case 0xc4, 0xc5, 0xc6:
+		size, err := m.readLength(tag - 0xc4)
+		if err != nil {
+			return nil, err
+		}
+		return m.readBytes(size)
+	case 0xc7, 0xc8, 0xc9:
+		size, err := m.readLength(tag - 0xc7)
+		if err != nil {
+			return nil, err
+		}
+		return m.readExt(size)
+	case 0xca:
+		buf, err := m.readBytes(4)
+		if err != nil {
+			return nil, err
+		}
+		return float64(math.Float32frombits(binary.BigEndian.Uint32(buf))), nil
+	case 0xcb:
+		buf, err := m.readBytes(8)
+		if err != nil {
+			return nil, err
+		}
+		return math.Float64frombits(binary.BigEndian.Uint64(buf)), nil
+	case 0xcc, 0xcd, 0xce, 0xcf:
+		buf, err := m.readBytes(1 << (tag - 0xcc))
+		if err != nil {
+			return nil, err
+		}
+		return float64(bigEndianUint(buf)), nil
+	case 0xd0, 0xd1, 0xd2, 0xd3:
+		buf, err := m.readBytes(1 << (tag - 0xd0))
+		if err != nil {
+			return nil, err
+		}
+		shift := 64 - 8*uint(len(buf))
+		return float64(int64(bigEndianUint(buf)<<shift) >> shift), nil
+	case 0xd4, 0xd5, 0xd6, 0xd7, 0xd8:
+		return m.readExt(1 << (tag - 0xd4))
+	case 0xd9, 0xda, 0xdb:
+		size, err := m.readLength(tag - 0xd9)
+		if err != nil {
+			return nil, err
+		}
+		data, err := m.readBytes(size)
+		return string(data), err
+	case 0xdc, 0xdd:
+		size, err := m.readLength(tag - 0xdc + 1)
+		if err != nil {
+			return nil, err
+		}
+		return m.readArray(size, depth)
+	case 0xde, 0xdf:
+		size, err := m.readLength(tag - 0xde + 1)
+		if err != nil {
+			return nil, err
+		}
+		return m.readMap(size, depth)
+	}
+	return nil, fmt.Errorf("msgpack: unknown type 0x%02x", tag)
+}
+
+// readLength reads a 1, 2 or 4 byte length for width 0, 1 or 2.
+func (m *msgpackReader) readLength(width byte) (int, error) {
+	buf, err := m.readBytes(1 << width)
+	if err != nil {
+		return 0, err
+	}
+	size := bigEndianUint(buf)
+	if size > msgpackMaxLength {
+		return 0, fmt.Errorf("msgpack: length %d too large", size)
+	}
+	return int(size), nil
+}
+
+func (m *msgpackReader) readBytes(size int) ([]byte, error) {
+	buf := make([]byte, size)
+	if _, err := io.ReadFull(m.r, buf); err != nil {
+		if err == io.EOF {
+			err = io.ErrUnexpectedEOF
+		}
+		return nil, err
+	}
+	return buf, nil
+}
+
+func (m *msgpackReader) readExt(size int) (msgpackExt, error) {
+	kind, err := m.r.ReadByte()
+	if err != nil {
+		return msgpackExt{}, err
+	}
+	data, err := m.readBytes(size)
+	return msgpackExt{kind: int8(kind), data: data}, err
+}
+
+func (m *msgpackReader) readArray(size, depth int) ([]interface{}, error) {
+	if depth >= msgpackMaxDepth {
+		return nil, fmt.Errorf("msgpack: nested deeper than %d levels", msgpackMaxDepth)
+	}
+	values := make([]interface{}, 0, min(size, 1024))
+	for i := 0; i < size; i++ {
+		value, err := m.decode(depth + 1)
+		if err != nil {
+			return nil, err
+		}
+		values = append(values, value)
+	}
+	return values, nil
+}
+
+func (m *msgpackReader) readMap(size, depth int) (map[string]interface{}, error) {
+	if depth >= msgpackMaxDepth {
+		return nil, fmt.Errorf("msgpack: nested deeper than %d levels", msgpackMaxDepth)
+	}
+	values := make(map[string]interface{}, min(size, 1024))
+	for i := 0; i < size; i++ {
+		key, err := m.decode(depth + 1)
+		if err != nil {
+			return nil, err
+		}
+		value, err := m.decode(depth + 1)
+		if err != nil {
+			return nil, err
+		}
+		switch k := key.(type) {
+		case string:
+			values[k] = value
+		case []byte:
+			values[string(k)] = value
+		default:
+			values[fmt.Sprint(k)] = value
+		}
+	}
+	return values, nil
+}
+
+func bigEndianUint(buf []byte) uint64 {
+	var n uint64
+	for _, b := range buf {
+		n = n<<8 | uint64(b)
+	}
+	return n
+}
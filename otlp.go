@@ -0,0 +1,431 @@
+package main
+
+import (
+	"bytes"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"math"
+	"net/http"
+	"strconv"
+	"time"
+)
+
+// The OTLP types below follow the JSON encoding of
+// opentelemetry.proto.collector.logs.v1.ExportLogsServiceRequest. Protobuf
+// requests are decoded into the same types.
+type otlpLogsRequest struct {
+	ResourceLogs []otlpResourceLogs `json:"resourceLogs"`
+}
+
+type otlpResourceLogs struct {
+	Resource  otlpResource    `json:"resource"`
+	ScopeLogs []otlpScopeLogs `json:"scopeLogs"`
+}
+
+type otlpResource struct {
+	Attributes []otlpKeyValue `json:"attributes"`
+}
+
+type otlpScopeLogs struct {
+	Scope      otlpScope       `json:"scope"`
+	LogRecords []otlpLogRecord `json:"logRecords"`
+}
+
+type otlpScope struct {
+	Name    string `json:"name"`
+	Version string `json:"version"`
+}
+
+type otlpLogRecord struct {
+	TimeUnixNano         otlpUint64     `json:"timeUnixNano"`
+	ObservedTimeUnixNano otlpUint64     `json:"observedTimeUnixNano"`
+	SeverityNumber       int            `json:"severityNumber"`
+	SeverityText         string         `json:"severityText"`
+	Body                 *otlpAnyValue  `json:"body"`
+	Attributes           []otlpKeyValue `json:"attributes"`
+	TraceID              string         `json:"traceId"`
+	SpanID               string         `json:"spanId"`
+	EventName            string         `json:"eventName"`
+}
+
+type otlpKeyValue struct {
+	Key   string       `json:"key"`
+	Value otlpAnyValue `json:"value"`
+}
+
+type otlpAnyValue struct {
+	StringValue *string     `json:"stringValue"`
+	BoolValue   *bool       `json:"boolValue"`
+	IntValue    *otlpInt64  `json:"intValue"`
+	DoubleValue *float64    `json:"doubleValue"`
+	ArrayValue  *otlpArray  `json:"arrayValue"`
+	KvlistValue *otlpKvlist `json:"kvlistValue"`
+	BytesValue  *otlpBytes  `json:"bytesValue"`
+}
+
+type otlpArray struct {
+	Values []otlpAnyValue `json:"values"`
+}
+
+type otlpKvlist struct {
+	Values []otlpKeyValue `json:"values"`
+}
+
+// otlpUint64 and otlpInt64 accept the decimal strings that the JSON mapping
+// uses for 64-bit integers as well as plain numbers.
+type otlpUint64 uint64
+
+func (v *otlpUint64) UnmarshalJSON(data []byte) error {
+	n, err := strconv.ParseUint(string(bytes.Trim(data, `"`)), 10, 64)
+	if err != nil {
+		return err
+	}
+	*v = otlpUint64(n)
+	return nil
+}
+
+type otlpInt64 int64
+
+func (v *otlpInt64) UnmarshalJSON(data []byte) error {
+	n, err := strconv.ParseInt(string(bytes.Trim(data, `"`)), 10, 64)
+	if err != nil {
+		return err
+	}
+	*v = otlpInt64(n)
+	return nil
+}
+
+type otlpBytes []byte
+
+func (v *otlpBytes) UnmarshalJSON(data []byte) error {
+	var encoded string
+	if err := json.Unmarshal(data, &encoded); err != nil {
+		return err
+	}
+	decoded, err := base64.StdEncoding.DecodeString(encoded)
+	if err != nil {
+		return err
+	}
+	*v = decoded
+	return nil
+}
+
+// value converts an AnyValue to the plain types used in entry fields.
+func (v otlpAnyValue) value() interface{} {
+	switch {
+	case v.StringValue != nil:
+		return *v.StringValue
+	case v.BoolValue != nil:
+		return *v.BoolValue
+	case v.IntValue != nil:
+		return float64(*v.IntValue)
+	case v.DoubleValue != nil:
+		return *v.DoubleValue
+	case v.ArrayValue != nil:
+		values := make([]interface{}, 0, len(v.ArrayValue.Values))
+		for _, item := range v.ArrayValue.Values {
+			values = append(values, item.value())
+		}
+		return values
+	case v.KvlistValue != nil:
+		return otlpAttributes(v.KvlistValue.Values)
+	case v.BytesValue != nil:
+		return base64.StdEncoding.EncodeToString(*v.BytesValue)
+	}
+	return nil
+}
+
+func otlpAttributes(values []otlpKeyValue) map[string]interface{} {
+	fields := make(map[string]interface{}, len(values))
+	for _, kv := range values {
+		fields[kv.Key] = kv.Value.value()
+	}
+	return fields
+}
+
+// serveOTLPLogs accepts OTLP/HTTP log exports in JSON or protobuf encoding.
+func serveOTLPLogs(pipeline *Pipeline) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodPost {
+			http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+			return
+		}
+		body, err := readIngestBody(w, r)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		var request otlpLogsRequest
+		protobuf := isProtobufRequest(r)
+		if protobuf {
+			err = decodeOTLPLogsProto(body, &request)
+		} else {
+			err = json.Unmarshal(body, &request)
+		}
+		if err != nil {
+			http.Error(w, fmt.Sprintf("invalid OTLP logs request: %v", err), http.StatusBadRequest)
+			return
+		}
+		for _, resourceLogs := range request.ResourceLogs {
+			resource := otlpAttributes(resourceLogs.Resource.Attributes)
+			for _, scopeLogs := range resourceLogs.ScopeLogs {
+				for _, record := range scopeLogs.LogRecords {
+					pipeline.Ingest(entryFromOTLP(record, scopeLogs.Scope, resource))
+				}
+			}
+		}
+		// An empty ExportLogsServiceResponse means every record was accepted.
+		if protobuf {
+			w.Header().Set("Content-Type", "application/x-protobuf")
+			w.WriteHeader(http.StatusOK)
+			return
+		}
+		w.Header().Set("Content-Type", "application/json")
+		_, _ = w.Write([]byte("{}"))
+	}
+}
+
+// entryFromOTLP flattens a log record into entry fields: record attributes
+// first, then resource attributes that do not clash, then the scope, trace
+// context, severity and body. A string body is also the message. The
+// service.name resource attribute becomes the channel.
+func entryFromOTLP(record otlpLogRecord, scope otlpScope, resource map[string]interface{}) LogEntry {
+	fields := otlpAttributes(record.Attributes)
+	for key, value := range resource {
+		assignIfMissing(fields, key, value)
+	}
+	if scope.Name != "" {
+		assignIfMissing(fields, "scope", scope.Name)
+	}
+	if scope.Version != "" {
+		assignIfMissing(fields, "scope_version", scope.Version)
+	}
+	if record.TraceID != "" {
+		fields["trace_id"] = record.TraceID
+	}
+	if record.SpanID != "" {
+		fields["span_id"] = record.SpanID
+	}
+	if record.EventName != "" {
+		assignIfMissing(fields, "event_name", record.EventName)
+	}
+	if record.SeverityText != "" {
+		fields["severity_text"] = record.SeverityText
+	}
+	if record.SeverityNumber != 0 {
+		fields["severity_number"] = float64(record.SeverityNumber)
+	}
+	var body interface{}
+	if record.Body != nil {
+		body = record.Body.value()
+	}
+	if body != nil {
+		fields["body"] = body
+	}
+
+	entry := entryFromFields(fields)
+	if msg, ok := body.(string); ok {
+		entry.Msg = msg
+	}
+	level, levelNum := "unknown", 0
+	if record.SeverityText != "" {
+		level, levelNum = levelFromString(record.SeverityText)
+	}
+	if level == "unknown" && record.SeverityNumber != 0 {
+		level, levelNum = levelOnScale("otel", record.SeverityNumber)
+	}
+	if level != "unknown" {
+		entry.Level, entry.LevelNum = level, levelNum
+	}
+	if record.TimeUnixNano != 0 {
+		setEntryTime(&entry, unixNanoTime(uint64(record.TimeUnixNano)))
+	} else if record.ObservedTimeUnixNano != 0 {
+		setEntryTime(&entry, unixNanoTime(uint64(record.ObservedTimeUnixNano)))
+	}
+	if entry.Channel == nil {
+		if service, ok := resource["service.name"]; ok {
+			entry.Channel = service
+		}
+	}
+	return entry
+}
+
+func unixNanoTime(nanos uint64) time.Time {
+	if nanos > math.MaxInt64 {
+		return time.Time{}
+	}
+	return time.Unix(0, int64(nanos))
+}
+
+func decodeOTLPLogsProto(buf []byte, request *otlpLogsRequest) error {
+	return walkProto(buf, func(f protoField) error {
+		if f.number != 1 || f.wire != wireBytes {
+			return nil
+		}
+		var resourceLogs otlpResourceLogs
+		if err := decodeOTLPResourceLogs(f.data, &resourceLogs); err != nil {
+			return err
+		}
+		request.ResourceLogs = append(request.ResourceLogs, resourceLogs)
+		return nil
+	})
+}
+
+func decodeOTLPResourceLogs(buf []byte, out *otlpResourceLogs) error {
+	return walkProto(buf, func(f protoField) error {
+		if f.wire != wireBytes {
+			return nil
+		}
+		switch f.number {
+		case 1:
+			return walkProto(f.data, func(rf protoField) error {
+				if rf.number == 1 && rf.wire == wireBytes {
+					kv, err := decodeOTLPKeyValue(rf.data, 0)
+					out.Resource.Attributes = append(out.Resource.Attributes, kv)
+					return err
+				}
+				return nil
+			})
+		case 2:
+			var scopeLogs otlpScopeLogs
+			if err := decodeOTLPScopeLogs(f.data, &scopeLogs); err != nil {
+				return err
+			}
+			out.ScopeLogs = append(out.ScopeLogs, scopeLogs)
+		}
+		return nil
+	})
+}
+
+func decodeOTLPScopeLogs(buf []byte, out *otlpScopeLogs) error {
+	return walkProto(buf, func(f protoField) error {
+		if f.wire != wireBytes {
+			return nil
+		}
+		switch f.number {
+		case 1:
+			return walkProto(f.data, func(sf protoField) error {
+				switch {
+				case sf.number == 1 && sf.wire == wireBytes:
+					out.Scope.Name = string(sf.data)
+				case sf.number == 2 && sf.wire == wireBytes:
+					out.Scope.Version = string(sf.data)
+				}
+				return nil
+			})
+		case 2:
+			var record otlpLogRecord
+			if err := decodeOTLPLogRecord(f.data, &record); err != nil {
+				return err
+			}
+			out.LogRecords = append(out.LogRecords, record)
+		}
+		return nil
+	})
+}
+
+func decodeOTLPLogRecord(buf []byte, out *otlpLogRecord) error {
+	return walkProto(buf, func(f protoField) error {
+		switch f.number {
+		case 1:
+			out.TimeUnixNano = otlpUint64(f.num)
+		case 11:
+			out.ObservedTimeUnixNano = otlpUint64(f.num)
+		case 2:
+			out.SeverityNumber = int(f.num)
+		case 3:
+			out.SeverityText = string(f.data)
+		case 5:
+			body, err := decodeOTLPAnyValue(f.data, 0)
+			if err != nil {
+				return err
+			}
+			out.Body = &body
+		case 6:
+			kv, err := decodeOTLPKeyValue(f.data, 0)
+			if err != nil {
+				return err
+			}
+			out.Attributes = append(out.Attributes, kv)
+		case 9:
+			out.TraceID = hex.EncodeToString(f.data)
+		case 10:
+			out.SpanID = hex.EncodeToString(f.data)
+		case 12:
+			out.EventName = string(f.data)
+		}
+		return nil
+	})
+}
+
+func decodeOTLPKeyValue(buf []byte, depth int) (otlpKeyValue, error) {
+	var kv otlpKeyValue
+	err := walkProto(buf, func(f protoField) error {
+		switch f.number {
+		case 1:
+			kv.Key = string(f.data)
+		case 2:
+			value, err := decodeOTLPAnyValue(f.data, depth)
+			if err != nil {
+				return err
+			}
+			kv.Value = value
+		}
+		return nil
+	})
+	return kv, err
+}
+
+// otlpMaxDepth bounds how deeply array and kvlist values may nest in a
+// protobuf request, so a peer cannot exhaust the stack.
+const otlpMaxDepth = 64
+
+func decodeOTLPAnyValue(buf []byte, depth int) (otlpAnyValue, error) {
+	var v otlpAnyValue
+	if depth >= otlpMaxDepth {
+		return v, fmt.Errorf("otlp: values nested deeper than %d levels", otlpMaxDepth)
+	}
+	err := walkProto(buf, func(f protoField) error {
+		switch f.number {
+		case 1:
+			s := string(f.data)
+			v.StringValue = &s
+		case 2:
+			b := f.num != 0
+			v.BoolValue = &b
+		case 3:
+			n := otlpInt64(int64(f.num))
+			v.IntValue = &n
+		case 4:
+			d := math.Float64frombits(f.num)
+			v.DoubleValue = &d
+		case 5:
+			v.ArrayValue = &otlpArray{}
+			return walkProto(f.data, func(af protoField) error {
+				if af.number != 1 {
+					return nil
+				}
+				item, err := decodeOTLPAnyValue(af.data, depth+1)
+				v.ArrayValue.Values = append(v.ArrayValue.Values, item)
+				return err
+			})
+		case 6:
+			v.KvlistValue = &otlpKvlist{}
+			return walkProto(f.data, func(kf protoField) error {
+				if kf.number != 1 {
+					return nil
+				}
+				kv, err := decodeOTLPKeyValue(kf.data, depth+1)
+				v.KvlistValue.Values = append(v.KvlistValue.Values, kv)
+				return err
+			})
+		case 7:
+			b := otlpBytes(append([]byte(nil), f.data...))
+			v.BytesValue = &b
+		}
+		return nil
+	})
+	return v, err
+}
@@ -0,0 +1,335 @@
+package main
+
+import (
+	"bufio"
+	"compress/gzip"
+	"encoding/json"
+	"fmt"
+	"io"
+	"log"
+	"net/url"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"sync/atomic"
+	"time"
+)
+
+const (
+	defaultOutputMaxSize = 100 << 20
+	defaultOutputKeep    = 5
+	outputQueueSize      = 4096
+	outputFlushInterval  = time.Second
+	// outputRotatedLayout stamps rotated files; it sorts chronologically.
+	outputRotatedLayout = "2006-01-02T15-04-05.000000000"
+	// outputRotatedLayoutMs is the coarser stamp used by earlier versions,
+	// still recognized when pruning.
+	outputRotatedLayoutMs = "2006-01-02T15-04-05.000"
+)
+
+// outputRecord is the normalized line written by file outputs.
+type outputRecord struct {
+	Time       string                 `json:"time,omitempty"`
+	Level      string                 `json:"level"`
+	Msg        string                 `json:"msg"`
+	Source     string                 `json:"source,omitempty"`
+	Channel    interface{}            `json:"channel,omitempty"`
+	Fields     map[string]interface{} `json:"fields,omitempty"`
+	ParseError string                 `json:"parseError,omitempty"`
+}
+
+// fileSink writes stored entries as NDJSON to a file, rotating it by size
+// and age. Entries are written from a goroutine so that a slow disk does not
+// hold up ingestion; if the queue overflows, entries are dropped.
+type fileSink struct {
+	path     string
+	maxSize  int64
+	interval time.Duration
+	keep     int
+	compress bool
+	filters  []filterExpression
+
+	queue   chan LogEntry
+	file    *os.File
+	writer  *bufio.Writer
+	size    int64
+	opened  time.Time
+	dropped atomic.Int64
+}
+
+// newFileSink parses an --output URL such as
+// file:///var/log/zlog/app.jsonl?max-size=50MB&rotate=24h&keep=7&filter=.level="warn".
+func newFileSink(spec string) (*fileSink, error) {
+	u, err := url.Parse(spec)
+	if err != nil {
+		return nil, err
+	}
+	if u.Scheme != "file" {
+		return nil, fmt.Errorf("%q: only file:// outputs are supported", spec)
+	}
+	path := u.Path
+	if path == "" {
+		path = u.Opaque
+	}
+	if path == "" {
+		return nil, fmt.Errorf("%q: missing file path", spec)
+	}
+	sink := &fileSink{
+		path:     filepath.Clean(path),
+		maxSize:  defaultOutputMaxSize,
+		keep:     defaultOutputKeep,
+		compress: true,
+		queue:    make(chan LogEntry, outputQueueSize),
+	}
+	query := u.Query()
+	for key, values := range query {
+		value := values[len(values)-1]
+		switch key {
+		case "max-size":
+			size, err := parseByteSize(value)
+			if err != nil {
+				return nil, fmt.Errorf("max-size: %w", err)
+			}
+			sink.maxSize = size
+		case "rotate":
+			interval, err := time.ParseDuration(value)
+			if err != nil {
+				return nil, fmt.Errorf("rotate: %w", err)
+			}
+			sink.interval = interval
+		case "keep":
+			keep, err := strconv.Atoi(value)
+			if err != nil || keep < 0 {
+				return nil, fmt.Errorf("keep: %q is not a count", value)
+			}
+			sink.keep = keep
+		case "gzip":
+			compress, err := strconv.ParseBool(value)
+			if err != nil {
+				return nil, fmt.Errorf("gzip: %w", err)
+			}
+			sink.compress = compress
+		case "filter":
+		default:
+			return nil, fmt.Errorf("unknown option %q", key)
+		}
+	}
+	sink.filters, err = parseFilterExpressions(query["filter"])
+	if err != nil {
+		return nil, fmt.Errorf("filter: %w", err)
+	}
+	if err := os.MkdirAll(filepath.Dir(sink.path), 0o755); err != nil {
+		return nil, err
+	}
+	if err := sink.open(); err != nil {
+		return nil, err
+	}
+	go sink.run()
+	return sink, nil
+}
+
+func (s *fileSink) Write(entry LogEntry) {
+	if !passesFilterExpressions(entry, s.filters) {
+		return
+	}
+	select {
+	case s.queue <- entry:
+	default:
+		if s.dropped.Add(1) == 1 {
+			log.Printf("output %s: falling behind, dropping entries", s.path)
+		}
+	}
+}
+
+func (s *fileSink) run() {
+	ticker := time.NewTicker(outputFlushInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case entry := <-s.queue:
+			if err := s.write(entry); err != nil {
+				log.Printf("output %s: %v", s.path, err)
+			}
+			if len(s.queue) == 0 {
+				_ = s.writer.Flush()
+			}
+		case now := <-ticker.C:
+			if s.interval > 0 && s.size > 0 && now.Sub(s.opened) >= s.interval {
+				if err := s.rotate(); err != nil {
+					log.Printf("output %s: %v", s.path, err)
+				}
+			}
+		}
+	}
+}
+
+func (s *fileSink) write(entry LogEntry) error {
+	line, err := json.Marshal(outputRecordOf(entry))
+	if err != nil {
+		return err
+	}
+	line = append(line, '\n')
+	if s.size > 0 && s.size+int64(len(line)) > s.maxSize {
+		if err := s.rotate(); err != nil {
+			return err
+		}
+	}
+	n, err := s.writer.Write(line)
+	s.size += int64(n)
+	return err
+}
+
+func outputRecordOf(entry LogEntry) outputRecord {
+	record := outputRecord{
+		Level:      entry.Level,
+		Msg:        entry.Msg,
+		Source:     entry.Source,
+		Channel:    getChannelValue(entry),
+		Fields:     entry.Fields,
+		ParseError: entry.ParseError,
+	}
+	if !entry.At.IsZero() {
+		record.Time = entry.At.Format(time.RFC3339Nano)
+	}
+	return record
+}
+
+func (s *fileSink) open() error {
+	file, err := os.OpenFile(s.path, os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0o644)
+	if err != nil {
+		return err
+	}
+	info, err := file.Stat()
+	if err != nil {
+		file.Close()
+		return err
+	}
+	s.file, s.size, s.opened = file, info.Size(), time.Now()
+	s.writer = bufio.NewWriterSize(file, 64*1024)
+	return nil
+}
+
+// rotate renames the current file with a timestamp, reopens the path and,
+// in the background, compresses the rotated file and prunes old ones.
+func (s *fileSink) rotate() error {
+	if err := s.writer.Flush(); err != nil {
+		return err
+	}
+	if err := s.file.Close(); err != nil {
+		return err
+	}
+	rotated := s.rotatedName(time.Now())
+	if err := os.Rename(s.path, rotated); err != nil {
+		return err
+	}
+	if err := s.open(); err != nil {
+		return err
+	}
+	go func() {
+		if s.compress {
+			if err := gzipFile(rotated); err != nil {
+				log.Printf("output %s: %v", rotated, err)
+			}
+		}
+		s.prune()
+	}()
+	return nil
+}
+
+// rotatedName returns a path for the file rotated at now that is not taken
+// by an earlier rotation, compressed or not, moving the stamp forward if it is.
+func (s *fileSink) rotatedName(now time.Time) string {
+	ext := filepath.Ext(s.path)
+	for ; ; now = now.Add(time.Nanosecond) {
+		name := fmt.Sprintf("%s-%s%s", strings.TrimSuffix(s.path, ext), now.Format(outputRotatedLayout), ext)
+		if _, err := os.Lstat(name); err == nil {
+			continue
+		}
+		if _, err := os.Lstat(name + ".gz"); err == nil {
+			continue
+		}
+		return name
+	}
+}
+
+// prune deletes rotated files beyond the newest keep.
+func (s *fileSink) prune() {
+	dir, base := filepath.Split(s.path)
+	ext := filepath.Ext(base)
+	prefix := strings.TrimSuffix(base, ext) + "-"
+	files, err := os.ReadDir(filepath.Clean(dir))
+	if err != nil {
+		return
+	}
+	var rotated []string
+	for _, file := range files {
+		name := file.Name()
+		if !strings.HasPrefix(name, prefix) {
+			continue
+		}
+		stamp := strings.TrimSuffix(strings.TrimSuffix(strings.TrimPrefix(name, prefix), ".gz"), ext)
+		if _, err := time.Parse(outputRotatedLayout, stamp); err == nil {
+			rotated = append(rotated, name)
+		} else if _, err := time.Parse(outputRotatedLayoutMs, stamp); err == nil {
+			rotated = append(rotated, name)
+		}
+	}
+	sort.Strings(rotated)
+	for len(rotated) > s.keep {
+		if err := os.Remove(filepath.Join(dir, rotated[0])); err != nil {
+			log.Printf("output %s: %v", s.path, err)
+		}
+		rotated = rotated[1:]
+	}
+}
+
+// gzipFile replaces path with path.gz.
+func gzipFile(path string) error {
+	in, err := os.Open(path)
+	if err != nil {
+		return err
+	}
+	defer in.Close()
+	out, err := os.Create(path + ".gz")
+	if err != nil {
+		return err
+	}
+	compressor := gzip.NewWriter(out)
+	if _, err := io.Copy(compressor, in); err != nil {
+		out.Close()
+		os.Remove(path + ".gz")
+		return err
+	}
+	if err := compressor.Close(); err != nil {
+		out.Close()
+		os.Remove(path + ".gz")
+		return err
+	}
+	if err := out.Close(); err != nil {
+		return err
+	}
+	in.Close()
+	return os.Remove(path)
+}
+
+// parseByteSize reads sizes such as 512, 64KB, 100MB or 1GB.
+func parseByteSize(value string) (int64, error) {
+	text := strings.ToUpper(strings.TrimSpace(value))
+	multiplier := int64(1)
+	for _, unit := range []struct {
+		suffix string
+		factor int64
+	}{{"GB", 1 << 30}, {"MB", 1 << 20}, {"KB", 1 << 10}, {"G", 1 << 30}, {"M", 1 << 20}, {"K", 1 << 10}, {"B", 1}} {
+		if strings.HasSuffix(text, unit.suffix) {
+			text, multiplier = strings.TrimSpace(strings.TrimSuffix(text, unit.suffix)), unit.factor
+			break
+		}
+	}
+	n, err := strconv.ParseInt(text, 10, 64)
+	if err != nil || n <= 0 {
+		return 0, fmt.Errorf("%q is not a size", value)
+	}
+	return n * multiplier, nil
+}
@@ -0,0 +1,157 @@
+package main
+
+import (
+	"fmt"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// linePattern extracts fields from a plain-text line with named capture
+// groups. Captures named msg, level, time and channel fill those roles
+// directly; everything else becomes a field.
+type linePattern struct {
+	name    string
+	regexes []*regexp.Regexp
+	derive  func(fields map[string]interface{})
+}
+
+var accessLogRegex = `^(?P<client>\S+) (?P<ident>\S+) (?P<user>\S+) \[(?P<time>[^\]]+)\] "(?P<method>[A-Z]+) (?P<path>\S+)(?: (?P<protocol>[^"]*))?" (?P<status>\d{3}) (?P<bytes>\d+|-)(?: "(?P<referer>[^"]*)" "(?P<user_agent>[^"]*)")?`
+
+// builtinPatterns covers common non-JSON formats. The access log pattern
+// matches nginx's default and Apache's common and combined formats.
+var builtinPatterns = map[string]linePattern{
+	"nginx":           newBuiltinPattern("nginx", deriveAccessLog, accessLogRegex),
+	"apache-combined": newBuiltinPattern("apache-combined", deriveAccessLog, accessLogRegex),
+	"klog": newBuiltinPattern("klog", deriveKlog,
+		`^(?P<severity>[IWEF])(?P<date>\d{4}) (?P<clock>\d{2}:\d{2}:\d{2}(?:\.\d+)?)\s+(?P<thread>\d+) (?P<source>[^\]\s]+)\] (?P<msg>.*)$`),
+	"python": newBuiltinPattern("python", nil,
+		`^(?P<time>\d{4}-\d{2}-\d{2} \d{2}:\d{2}:\d{2}(?:[,.]\d+)?) - (?P<channel>\S+) - (?P<level>[A-Z]+) - (?P<msg>.*)$`,
+		`^(?P<level>DEBUG|INFO|WARNING|ERROR|CRITICAL):(?P<channel>[^:]*):(?P<msg>.*)$`),
+	"rails": newBuiltinPattern("rails", nil,
+		`^[DIWEFA], \[(?P<time>\S+) #(?P<pid>\d+)\]\s+(?P<level>[A-Z]+) -- (?P<progname>[^:]*): (?P<msg>.*)$`),
+}
+
+func newBuiltinPattern(name string, derive func(map[string]interface{}), exprs ...string) linePattern {
+	pattern := linePattern{name: name, derive: derive}
+	for _, expr := range exprs {
+		pattern.regexes = append(pattern.regexes, regexp.MustCompile(expr))
+	}
+	return pattern
+}
+
+// parseLinePattern resolves a --pattern value: the name of a built-in
+// pattern, or a regex with at least one named capture group.
+func parseLinePattern(raw string) (linePattern, error) {
+	if pattern, ok := builtinPatterns[strings.ToLower(strings.TrimSpace(raw))]; ok {
+		return pattern, nil
+	}
+	compiled, err := regexp.Compile(raw)
+	if err != nil {
+		return linePattern{}, fmt.Errorf("%q: %w", raw, err)
+	}
+	named := false
+	for _, name := range compiled.SubexpNames() {
+		if name != "" {
+			named = true
+			break
+		}
+	}
+	if !named {
+		return linePattern{}, fmt.Errorf("%q: pattern has no named capture groups", raw)
+	}
+	return linePattern{name: raw, regexes: []*regexp.Regexp{compiled}}, nil
+}
+
+// matchLinePatterns returns the captured fields of the first pattern that
+// matches line.
+func matchLinePatterns(line string, patterns []linePattern) (map[string]interface{}, bool) {
+	for _, pattern := range patterns {
+		for _, re := range pattern.regexes {
+			match := re.FindStringSubmatch(line)
+			if match == nil {
+				continue
+			}
+			fields := map[string]interface{}{}
+			for i, name := range re.SubexpNames() {
+				if name == "" || match[i] == "" {
+					continue
+				}
+				fields[name] = coerceCapture(match[i])
+			}
+			if pattern.derive != nil {
+				pattern.derive(fields)
+			}
+			return fields, true
+		}
+	}
+	return nil, false
+}
+
+var captureNumberRegex = regexp.MustCompile(`^-?\d+(\.\d+)?$`)
+
+// coerceCapture turns numeric captures into numbers so comparisons such as
+// .status >= 500 behave like they do on JSON fields.
+func coerceCapture(value string) interface{} {
+	if captureNumberRegex.MatchString(value) {
+		if num, err := strconv.ParseFloat(value, 64); err == nil {
+			return num
+		}
+	}
+	return value
+}
+
+// applyPatternFields fills the entry from pattern captures. It runs the usual
+// key detection first and then lets the reserved capture names win.
+func applyPatternFields(entry *LogEntry, fields map[string]interface{}) {
+	applyFields(entry, fields, currentProfile())
+	if msg, ok := fields["msg"]; ok {
+		entry.Msg = fmt.Sprint(msg)
+	}
+	if level, ok := fields["level"]; ok {
+		entry.Level, entry.LevelNum = normalizeLevel(level)
+	}
+	if raw, ok := fields["time"]; ok {
+		if t, ok := parseTimeValue(raw); ok {
+			entry.At = t
+			entry.Time = formatTime(t)
+		}
+	}
+	if channel, ok := fields["channel"]; ok {
+		entry.Channel = channel
+	}
+}
+
+func deriveAccessLog(fields map[string]interface{}) {
+	status, _ := fields["status"].(float64)
+	switch {
+	case status >= 500:
+		fields["level"] = "error"
+	case status >= 400:
+		fields["level"] = "warn"
+	default:
+		fields["level"] = "info"
+	}
+}
+
+func deriveKlog(fields map[string]interface{}) {
+	switch fields["severity"] {
+	case "I":
+		fields["level"] = "info"
+	case "W":
+		fields["level"] = "warn"
+	case "E":
+		fields["level"] = "error"
+	case "F":
+		fields["level"] = "fatal"
+	}
+	// klog's MMDD header has no year; fields are numbers after coercion, so
+	// rebuild the text with zero padding before parsing.
+	date := fmt.Sprintf("%04v", fields["date"])
+	clock := fmt.Sprint(fields["clock"])
+	t, err := time.ParseInLocation("0102 15:04:05", date+" "+clock, currentProfile().sourceLocation)
+	if err == nil {
+		fields["time"] = completeYear(t).Format(time.RFC3339Nano)
+	}
+}
@@ -0,0 +1,74 @@
+package main
+
+import (
+	"encoding/json"
+	"regexp"
+	"strings"
+)
+
+// linePrefixes recognise the text that container tooling puts in front of a
+// JSON log line. Named groups become fields of the entry.
+var linePrefixes = []*regexp.Regexp{
+	// kubectl logs --prefix: "[pod/api-7f9/app] "
+	regexp.MustCompile(`^\[pod/(?P<pod>[^/\]]+)/(?P<container>[^\]]+)\]\s*$`),
+	// docker compose: "api-1  | "
+	regexp.MustCompile(`^(?P<service>[\w.-]+)\s+\|\s*$`),
+}
+
+// maxPrefixAttempts bounds how many '{' positions are tried, so long plain
+// lines full of braces stay cheap.
+const maxPrefixAttempts = 4
+
+// splitJSONPrefix finds a JSON object embedded after a text prefix.
+func splitJSONPrefix(line string) (string, map[string]interface{}, bool) {
+	trimmed := strings.TrimRight(line, " \t")
+	if !strings.HasSuffix(trimmed, "}") {
+		return "", nil, false
+	}
+	offset := 0
+	for attempt := 0; attempt < maxPrefixAttempts; attempt++ {
+		i := strings.IndexByte(trimmed[offset:], '{')
+		if i < 0 {
+			break
+		}
+		start := offset + i
+		if start > 0 {
+			var payload map[string]interface{}
+			if err := json.Unmarshal([]byte(trimmed[start:]), &payload); err == nil {
+				return trimmed[:start], payload, true
+			}
+		}
+		offset = start + 1
+	}
+	return "", nil, false
+}
+
+// parseLinePrefix breaks a known prefix into its components. Unknown
+// prefixes are kept whole under "prefix".
+func parseLinePrefix(prefix string) map[string]interface{} {
+	fields := map[string]interface{}{}
+	for _, re := range linePrefixes {
+		match := re.FindStringSubmatch(prefix)
+		if match == nil {
+			continue
+		}
+		for i, name := range re.SubexpNames() {
+			if name != "" && match[i] != "" {
+				fields[name] = match[i]
+			}
+		}
+		return fields
+	}
+	if trimmed := strings.TrimSpace(prefix); trimmed != "" {
+		fields["prefix"] = trimmed
+	}
+	return fields
+}
+
+// applyPrefixFields adds prefix components to the payload without replacing
+// anything the application logged itself.
+func applyPrefixFields(payload map[string]interface{}, prefix map[string]interface{}) {
+	for key, value := range prefix {
+		assignIfMissing(payload, key, value)
+	}
+}
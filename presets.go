@@ -0,0 +1,240 @@
+package main
+
+import (
+	"log"
+	"sort"
+	"strings"
+	"sync"
+)
+
+// logPreset describes the JSON shape of a popular logging library. Empty key
+// lists keep the defaults.
+type logPreset struct {
+	messageKeys  []string
+	levelKeys    []string
+	timeKeys     []string
+	channelKeys  []string
+	levelNames   map[string]string
+	levelScale   string
+	defaultLevel string
+	timeLayouts  []string
+	detect       func(fields map[string]interface{}) bool
+}
+
+var logPresets = map[string]logPreset{
+	"zap": {
+		messageKeys: []string{"msg"},
+		levelKeys:   []string{"level"},
+		timeKeys:    []string{"ts"},
+		channelKeys: []string{"logger"},
+		levelNames:  map[string]string{"dpanic": "error"},
+		timeLayouts: []string{"2006-01-02T15:04:05.000Z0700"},
+		detect: func(fields map[string]interface{}) bool {
+			return hasFields(fields, "msg", "level", "ts") && isNumberField(fields, "ts")
+		},
+	},
+	"zerolog": {
+		messageKeys: []string{"message"},
+		levelKeys:   []string{"level"},
+		timeKeys:    []string{"time"},
+		detect: func(fields map[string]interface{}) bool {
+			return hasFields(fields, "message", "level", "time")
+		},
+	},
+	"logrus": {
+		messageKeys: []string{"msg"},
+		levelKeys:   []string{"level"},
+		timeKeys:    []string{"time"},
+		detect: func(fields map[string]interface{}) bool {
+			return hasFields(fields, "msg", "level", "time") && isLowerField(fields, "level")
+		},
+	},
+	"slog": {
+		messageKeys: []string{"msg"},
+		levelKeys:   []string{"level"},
+		timeKeys:    []string{"time"},
+		detect: func(fields map[string]interface{}) bool {
+			return hasFields(fields, "msg", "level", "time") && isUpperField(fields, "level")
+		},
+	},
+	"bunyan": {
+		messageKeys: []string{"msg"},
+		levelKeys:   []string{"level"},
+		timeKeys:    []string{"time"},
+		channelKeys: []string{"name"},
+		detect: func(fields map[string]interface{}) bool {
+			return hasFields(fields, "v", "msg", "level", "name", "hostname", "pid", "time")
+		},
+	},
+	"pino": {
+		messageKeys: []string{"msg"},
+		levelKeys:   []string{"level"},
+		timeKeys:    []string{"time"},
+		channelKeys: []string{"name"},
+		detect: func(fields map[string]interface{}) bool {
+			return hasFields(fields, "level", "time", "pid", "hostname") &&
+				isNumberField(fields, "level") && isNumberField(fields, "time")
+		},
+	},
+	"winston": {
+		messageKeys: []string{"message"},
+		levelKeys:   []string{"level"},
+		timeKeys:    []string{"timestamp"},
+		levelNames:  map[string]string{"http": "debug", "verbose": "debug", "silly": "trace"},
+		detect: func(fields map[string]interface{}) bool {
+			return hasFields(fields, "message", "level") && isLowerField(fields, "level")
+		},
+	},
+	"serilog": {
+		messageKeys:  []string{"@m", "@mt", "RenderedMessage", "MessageTemplate"},
+		levelKeys:    []string{"@l", "Level"},
+		timeKeys:     []string{"@t", "Timestamp"},
+		channelKeys:  []string{"SourceContext"},
+		levelNames:   map[string]string{"verbose": "trace"},
+		defaultLevel: "info",
+		detect: func(fields map[string]interface{}) bool {
+			return hasFields(fields, "@t") && (hasFields(fields, "@mt") || hasFields(fields, "@m"))
+		},
+	},
+	"log4j2-json": {
+		messageKeys: []string{"message"},
+		levelKeys:   []string{"level"},
+		timeKeys:    []string{"timeMillis", "instant.epochSecond"},
+		channelKeys: []string{"loggerName"},
+		detect: func(fields map[string]interface{}) bool {
+			return hasFields(fields, "level", "loggerName", "thread")
+		},
+	},
+	"gcp": {
+		messageKeys: []string{"message", "textPayload"},
+		levelKeys:   []string{"severity"},
+		timeKeys:    []string{"time", "timestamp", "timestampSeconds"},
+		levelNames:  map[string]string{"default": "unknown"},
+		levelScale:  "gcp",
+		detect: func(fields map[string]interface{}) bool {
+			return hasFields(fields, "severity", "message") && isUpperField(fields, "severity")
+		},
+	},
+	"ecs": {
+		messageKeys: []string{"message"},
+		levelKeys:   []string{"log.level"},
+		timeKeys:    []string{"@timestamp"},
+		channelKeys: []string{"log.logger", "service.name"},
+		detect: func(fields map[string]interface{}) bool {
+			return hasFields(fields, "@timestamp", "log.level")
+		},
+	},
+}
+
+// presetDetectionOrder lists presets from the most to the least specific
+// signature, since several libraries share the msg/level/time trio.
+var presetDetectionOrder = []string{
+	"serilog", "ecs", "bunyan", "pino", "log4j2-json", "gcp",
+	"zap", "slog", "logrus", "zerolog", "winston",
+}
+
+const presetDetectionLines = 20
+
+func presetNames() []string {
+	names := make([]string, 0, len(logPresets))
+	for name := range logPresets {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+func (p logPreset) apply(profile *parseProfile) error {
+	if err := setFieldKeys(&profile.messageKeys, p.messageKeys); err != nil {
+		return err
+	}
+	if err := setFieldKeys(&profile.levelKeys, p.levelKeys); err != nil {
+		return err
+	}
+	if err := setFieldKeys(&profile.timeKeys, p.timeKeys); err != nil {
+		return err
+	}
+	if err := setFieldKeys(&profile.channelKeys, p.channelKeys); err != nil {
+		return err
+	}
+	profile.levelNames = p.levelNames
+	profile.levelScale = p.levelScale
+	profile.defaultLevel = p.defaultLevel
+	profile.timeLayouts = p.timeLayouts
+	return nil
+}
+
+func detectPreset(fields map[string]interface{}) string {
+	for _, name := range presetDetectionOrder {
+		if logPresets[name].detect(fields) {
+			return name
+		}
+	}
+	return ""
+}
+
+// presetDetector inspects the first JSON entries when --preset auto is used
+// and swaps in the matching preset's profile once one is recognised.
+type presetDetector struct {
+	mu        sync.Mutex
+	settings  profileSettings
+	remaining int
+}
+
+func newPresetDetector(settings profileSettings) *presetDetector {
+	return &presetDetector{settings: settings, remaining: presetDetectionLines}
+}
+
+func (d *presetDetector) observe(fields map[string]interface{}) *parseProfile {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	if d.remaining <= 0 {
+		return currentProfile()
+	}
+	d.remaining--
+	settings := d.settings
+	if name := detectPreset(fields); name != "" {
+		settings.preset = name
+		log.Printf("detected %s log format", name)
+	} else if d.remaining > 0 {
+		return currentProfile()
+	} else {
+		settings.preset = ""
+	}
+	d.remaining = 0
+	profile, err := buildParseProfile(settings)
+	if err != nil {
+		log.Printf("preset detection: %v", err)
+		return currentProfile()
+	}
+	activeProfile.Store(profile)
+	return profile
+}
+
+func hasFields(fields map[string]interface{}, keys ...string) bool {
+	for _, key := range keys {
+		path, err := parseFieldPath(key)
+		if err != nil {
+			return false
+		}
+		if _, ok := lookupField(fields, path); !ok {
+			return false
+		}
+	}
+	return true
+}
+
+func isNumberField(fields map[string]interface{}, key string) bool {
+	_, ok := fields[key].(float64)
+	return ok
+}
+
+func isLowerField(fields map[string]interface{}, key string) bool {
+	value, ok := fields[key].(string)
+	return ok && value != "" && value == strings.ToLower(value)
+}
+
+func isUpperField(fields map[string]interface{}, key string) bool {
+	value, ok := fields[key].(string)
+	return ok && value != "" && value == strings.ToUpper(value)
+}
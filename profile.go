@@ -0,0 +1,175 @@
+package main
+
+import (
+	"fmt"
+	"strings"
+	"sync/atomic"
+	"time"
+)
+
+// parseProfile holds everything parseLine needs to interpret a JSON entry.
+// It is built once at startup and only replaced wholesale, so readers take a
+// snapshot with currentProfile and never see a half-applied change.
+type parseProfile struct {
+	preset       string
+	messageKeys  []fieldPath
+	levelKeys    []fieldPath
+	timeKeys     []fieldPath
+	channelKeys  []fieldPath
+	levelNames   map[string]string
+	levelScale   string
+	extraLevels  map[string]bool
+	defaultLevel string
+	timeLayouts  []string
+	patterns     []linePattern
+	// decodeJSON decodes JSON held in any string field, decodeJSONPaths
+	// only in the listed ones.
+	decodeJSON      bool
+	decodeJSONPaths []fieldPath
+	// format is formatLines, formatCSV, formatTSV or formatJournal.
+	format string
+	// ansiMode is one of ansiStrip, ansiSpans or ansiKeep.
+	ansiMode string
+	// sourceLocation applies to timestamps without an offset and
+	// displayLocation is where entry times are rendered.
+	sourceLocation  *time.Location
+	displayLocation *time.Location
+	detector        *presetDetector
+}
+
+// profileSettings are the user's explicit choices, which take precedence
+// over whatever a preset configures.
+type profileSettings struct {
+	preset      string
+	messageKeys []string
+	levelKeys   []string
+	timeKeys    []string
+	channelKeys []string
+	levelMap    []string
+	levelScale  string
+	extraLevels []string
+	timeLayouts []string
+	patterns    []string
+	decodeJSON  bool
+	decodePaths []string
+	ansi        string
+	format      string
+	displayTZ   string
+	sourceTZ    string
+}
+
+var activeProfile atomic.Pointer[parseProfile]
+
+func init() {
+	activeProfile.Store(defaultParseProfile())
+}
+
+func currentProfile() *parseProfile {
+	return activeProfile.Load()
+}
+
+func defaultParseProfile() *parseProfile {
+	return &parseProfile{
+		messageKeys:     mustParseFieldPaths("msg", "message", "event", "error", "err"),
+		levelKeys:       mustParseFieldPaths("level", "severity", "lvl", "level_name"),
+		timeKeys:        mustParseFieldPaths("time", "timestamp", "ts", "@timestamp"),
+		channelKeys:     mustParseFieldPaths("channel", "chanel"),
+		ansiMode:        ansiStrip,
+		sourceLocation:  time.UTC,
+		displayLocation: time.Local,
+	}
+}
+
+func buildParseProfile(settings profileSettings) (*parseProfile, error) {
+	profile := defaultParseProfile()
+	switch settings.preset {
+	case "":
+	case "auto":
+		profile.detector = newPresetDetector(settings)
+	default:
+		preset, ok := logPresets[settings.preset]
+		if !ok {
+			return nil, fmt.Errorf("unknown preset %q (available: auto, %s)", settings.preset, strings.Join(presetNames(), ", "))
+		}
+		if err := preset.apply(profile); err != nil {
+			return nil, err
+		}
+		profile.preset = settings.preset
+	}
+	if len(settings.levelMap) > 0 {
+		mapping, err := parseLevelMap(settings.levelMap)
+		if err != nil {
+			return nil, fmt.Errorf("invalid --level-map: %w", err)
+		}
+		merged := make(map[string]string, len(profile.levelNames)+len(mapping))
+		for name, level := range profile.levelNames {
+			merged[name] = level
+		}
+		for name, level := range mapping {
+			merged[name] = level
+		}
+		profile.levelNames = merged
+	}
+	if settings.levelScale != "" {
+		if _, ok := levelScales[settings.levelScale]; !ok {
+			return nil, fmt.Errorf("unknown level scale %q (available: %s)", settings.levelScale, strings.Join(levelScaleNames(), ", "))
+		}
+		profile.levelScale = settings.levelScale
+	}
+	if len(settings.timeLayouts) > 0 {
+		profile.timeLayouts = append(append([]string{}, settings.timeLayouts...), profile.timeLayouts...)
+	}
+	profile.decodeJSON = settings.decodeJSON
+	if err := setFieldKeys(&profile.decodeJSONPaths, settings.decodePaths); err != nil {
+		return nil, fmt.Errorf("invalid --decode-json-path: %w", err)
+	}
+	format, err := parseInputFormat(settings.format)
+	if err != nil {
+		return nil, fmt.Errorf("invalid --format: %w", err)
+	}
+	profile.format = format
+	ansiMode, err := parseANSIMode(settings.ansi)
+	if err != nil {
+		return nil, fmt.Errorf("invalid --ansi: %w", err)
+	}
+	profile.ansiMode = ansiMode
+	for _, raw := range settings.patterns {
+		pattern, err := parseLinePattern(raw)
+		if err != nil {
+			return nil, fmt.Errorf("invalid --pattern: %w", err)
+		}
+		profile.patterns = append(profile.patterns, pattern)
+	}
+	if settings.sourceTZ != "" {
+		location, err := loadTimeZone(settings.sourceTZ)
+		if err != nil {
+			return nil, fmt.Errorf("invalid --source-tz: %w", err)
+		}
+		profile.sourceLocation = location
+	}
+	if settings.displayTZ != "" {
+		location, err := loadTimeZone(settings.displayTZ)
+		if err != nil {
+			return nil, fmt.Errorf("invalid --tz: %w", err)
+		}
+		profile.displayLocation = location
+	}
+	extra, err := parseExtraLevels(settings.extraLevels)
+	if err != nil {
+		return nil, fmt.Errorf("invalid --extra-levels: %w", err)
+	}
+	profile.extraLevels = extra
+	if err := setFieldKeys(&profile.messageKeys, settings.messageKeys); err != nil {
+		return nil, fmt.Errorf("invalid --msg-key: %w", err)
+	}
+	if err := setFieldKeys(&profile.levelKeys, settings.levelKeys); err != nil {
+		return nil, fmt.Errorf("invalid --level-key: %w", err)
+	}
+	if err := setFieldKeys(&profile.timeKeys, settings.timeKeys); err != nil {
+		return nil, fmt.Errorf("invalid --time-key: %w", err)
+	}
+	if err := setFieldKeys(&profile.channelKeys, settings.channelKeys); err != nil {
+		return nil, fmt.Errorf("invalid --channel-key: %w", err)
+	}
+	return profile, nil
+}
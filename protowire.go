@@ -0,0 +1,72 @@
+package main
+
+import (
+	"encoding/binary"
+	"errors"
+	"fmt"
+)
+
+// Protobuf wire types used by the receivers that accept protobuf bodies.
+const (
+	wireVarint  = 0
+	wireFixed64 = 1
+	wireBytes   = 2
+	wireFixed32 = 5
+)
+
+var errProtoTruncated = errors.New("protobuf: truncated message")
+
+// protoField is one decoded field of a protobuf message: num holds varint
+// and fixed values, data holds length-delimited ones.
+type protoField struct {
+	number int
+	wire   int
+	num    uint64
+	data   []byte
+}
+
+// walkProto calls fn for every field of the message in buf. It decodes just
+// the wire format, which keeps the receivers free of generated code.
+func walkProto(buf []byte, fn func(protoField) error) error {
+	for len(buf) > 0 {
+		key, n := binary.Uvarint(buf)
+		if n <= 0 {
+			return errProtoTruncated
+		}
+		buf = buf[n:]
+		field := protoField{number: int(key >> 3), wire: int(key & 7)}
+		switch field.wire {
+		case wireVarint:
+			field.num, n = binary.Uvarint(buf)
+			if n <= 0 {
+				return errProtoTruncated
+			}
+			buf = buf[n:]
+		case wireFixed64:
+			if len(buf) < 8 {
+				return errProtoTruncated
+			}
+			field.num = binary.LittleEndian.Uint64(buf)
+			buf = buf[8:]
+		case wireFixed32:
+			if len(buf) < 4 {
+				return errProtoTruncated
+			}
+			field.num = uint64(binary.LittleEndian.Uint32(buf))
+			buf = buf[4:]
+		case wireBytes:
+			size, n := binary.Uvarint(buf)
+			if n <= 0 || uint64(len(buf)-n) < size {
+				return errProtoTruncated
+			}
+			field.data = buf[n : n+int(size)]
+			buf = buf[n+int(size):]
+		default:
+			return fmt.Errorf("protobuf: unsupported wire type %d", field.wire)
+		}
+		if err := fn(field); err != nil {
+			return err
+		}
+	}
+	return nil
+}
@@ -0,0 +1,92 @@
+package main
+
+import (
+	"sort"
+	"sync"
+	"time"
+)
+
+// reorderBuffer holds entries for a short window and releases them sorted by
+// their own time, so that several inputs merged into one view read in
+// chronological order. Entries without a time sort by when they arrived.
+type reorderBuffer struct {
+	mu      sync.Mutex
+	window  time.Duration
+	pending []reorderItem
+	emit    func(LogEntry)
+}
+
+type reorderItem struct {
+	entry   LogEntry
+	key     time.Time
+	arrived time.Time
+}
+
+func newReorderBuffer(window time.Duration, emit func(LogEntry)) *reorderBuffer {
+	b := &reorderBuffer{window: window, emit: emit}
+	go b.run()
+	return b
+}
+
+func (b *reorderBuffer) Push(entry LogEntry) {
+	now := time.Now()
+	key := entry.At
+	if key.IsZero() {
+		key = now
+	}
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.pending = append(b.pending, reorderItem{entry: entry, key: key, arrived: now})
+}
+
+func (b *reorderBuffer) run() {
+	tick := b.window / 4
+	if tick < 10*time.Millisecond {
+		tick = 10 * time.Millisecond
+	}
+	ticker := time.NewTicker(tick)
+	defer ticker.Stop()
+	for now := range ticker.C {
+		for _, entry := range b.release(now) {
+			b.emit(entry)
+		}
+	}
+}
+
+// release takes every entry that has waited out the window, along with any
+// entry that sorts before one of them, so nothing waits longer than the
+// window and what is released is in order.
+func (b *reorderBuffer) release(now time.Time) []LogEntry {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	var cutoff time.Time
+	for _, item := range b.pending {
+		if now.Sub(item.arrived) >= b.window && item.key.After(cutoff) {
+			cutoff = item.key
+		}
+	}
+	if cutoff.IsZero() {
+		return nil
+	}
+	var ready []reorderItem
+	kept := b.pending[:0]
+	for _, item := range b.pending {
+		if item.key.After(cutoff) {
+			kept = append(kept, item)
+		} else {
+			ready = append(ready, item)
+		}
+	}
+	for i := len(kept); i < len(b.pending); i++ {
+		b.pending[i] = reorderItem{}
+	}
+	b.pending = kept
+	sort.SliceStable(ready, func(i, j int) bool {
+		return ready[i].key.Before(ready[j].key)
+	})
+	entries := make([]LogEntry, len(ready))
+	for i, item := range ready {
+		entries[i] = item.entry
+	}
+	return entries
+}
@@ -0,0 +1,323 @@
+package main
+
+import (
+	"encoding/json"
+	"flag"
+	"fmt"
+	"io"
+	"math"
+	"net/http"
+	"os"
+	"strconv"
+	"sync"
+	"time"
+)
+
+type replayItem struct {
+	line   string
+	offset time.Duration
+}
+
+// Replayer feeds a recorded log file into the pipeline, spacing entries by the
+// gaps between their original timestamps. Lines without a usable timestamp
+// are emitted right after the line before them.
+type Replayer struct {
+	mu        sync.Mutex
+	pipeline  *Pipeline
+	source    string
+	items     []replayItem
+	pos       int
+	speed     float64
+	paused    bool
+	cursor    time.Duration
+	resumedAt time.Time
+	gen       int
+	wake      chan struct{}
+}
+
+type replayStatus struct {
+	Source   string  `json:"source"`
+	Speed    float64 `json:"speed"`
+	Paused   bool    `json:"paused"`
+	Done     bool    `json:"done"`
+	Index    int     `json:"index"`
+	Total    int     `json:"total"`
+	Position string  `json:"position"`
+	Duration string  `json:"duration"`
+}
+
+func newReplayerFromArgs(pipeline *Pipeline, args []string) (*Replayer, error) {
+	fset := flag.NewFlagSet("replay", flag.ContinueOnError)
+	speed := fset.Float64("speed", 1, "Playback speed multiplier")
+	start := fset.Duration("start", 0, "Offset into the recording to start from")
+	paused := fset.Bool("paused", false, "Start paused and wait for /replay/resume")
+	fset.Usage = func() {
+		_, _ = fmt.Fprintf(fset.Output(), "Usage: zlog [flags] replay [replay flags] <file.jsonl>\n")
+		fset.VisitAll(func(f *flag.Flag) {
+			_, _ = fmt.Fprintf(fset.Output(), "  --%s %s\n        %s\n", f.Name, valueTypeHint(f), f.Usage)
+		})
+	}
+	if err := fset.Parse(args); err != nil {
+		return nil, err
+	}
+	if fset.NArg() != 1 {
+		fset.Usage()
+		return nil, fmt.Errorf("expected exactly one file to replay")
+	}
+	if currentProfile().format != formatLines {
+		return nil, fmt.Errorf("replay reads line-based recordings only, not --format %s", currentProfile().format)
+	}
+	if !validSpeed(*speed) {
+		return nil, fmt.Errorf("speed must be a positive number")
+	}
+
+	path := fset.Arg(0)
+	var input io.Reader = os.Stdin
+	if path != "-" {
+		file, err := os.Open(path)
+		if err != nil {
+			return nil, err
+		}
+		defer file.Close()
+		input = file
+	}
+	items, err := loadReplayItems(input)
+	if err != nil {
+		return nil, err
+	}
+
+	replayer := NewReplayer(pipeline, path, items, *speed)
+	replayer.paused = *paused
+	replayer.Seek(*start)
+	return replayer, nil
+}
+
+func loadReplayItems(r io.Reader) ([]replayItem, error) {
+	input, err := decompressReader(r)
+	if err != nil {
+		return nil, err
+	}
+	defer input.Close()
+	scanner := newLineScanner(input)
+	assembler := newLineAssembler()
+	var items []replayItem
+	var origin time.Time
+	var last time.Duration
+	add := func(line string) {
+		if t := entryFromLine(line).At; !t.IsZero() {
+			if origin.IsZero() {
+				origin = t
+			}
+			// Out-of-order timestamps never move the clock backwards; the
+			// line is emitted immediately instead.
+			if offset := t.Sub(origin); offset > last {
+				last = offset
+			}
+		}
+		items = append(items, replayItem{line: line, offset: last})
+	}
+	for scanner.Scan() {
+		if line, ok := assembler.Push(scanner.Text()); ok {
+			add(line)
+		}
+	}
+	for _, line := range assembler.Flush() {
+		add(line)
+	}
+	return items, scanner.Err()
+}
+
+func NewReplayer(pipeline *Pipeline, source string, items []replayItem, speed float64) *Replayer {
+	return &Replayer{
+		pipeline:  pipeline,
+		source:    source,
+		items:     items,
+		speed:     speed,
+		resumedAt: time.Now(),
+		wake:      make(chan struct{}, 1),
+	}
+}
+
+func (r *Replayer) Run() {
+	for {
+		r.mu.Lock()
+		if r.paused || r.pos >= len(r.items) {
+			r.mu.Unlock()
+			<-r.wake
+			continue
+		}
+		gen := r.gen
+		wait := time.Duration(float64(r.items[r.pos].offset-r.position()) / r.speed)
+		r.mu.Unlock()
+
+		if wait > 0 {
+			timer := time.NewTimer(wait)
+			select {
+			case <-timer.C:
+			case <-r.wake:
+				timer.Stop()
+				continue
+			}
+		}
+
+		r.mu.Lock()
+		if gen != r.gen {
+			r.mu.Unlock()
+			continue
+		}
+		line := r.items[r.pos].line
+		r.pos++
+		r.mu.Unlock()
+
+		r.pipeline.Ingest(entryFromLine(line))
+	}
+}
+
+// position returns the current offset into the recording. Callers must hold mu.
+func (r *Replayer) position() time.Duration {
+	if r.paused {
+		return r.cursor
+	}
+	return r.cursor + time.Duration(float64(time.Since(r.resumedAt))*r.speed)
+}
+
+// changed records a control change and wakes Run. Callers must hold mu.
+func (r *Replayer) changed() {
+	r.gen++
+	select {
+	case r.wake <- struct{}{}:
+	default:
+	}
+}
+
+func (r *Replayer) Pause() {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if r.paused {
+		return
+	}
+	r.cursor = r.position()
+	r.paused = true
+	r.changed()
+}
+
+func (r *Replayer) Resume() {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if !r.paused {
+		return
+	}
+	r.paused = false
+	r.resumedAt = time.Now()
+	r.changed()
+}
+
+func (r *Replayer) SetSpeed(speed float64) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.cursor = r.position()
+	r.resumedAt = time.Now()
+	r.speed = speed
+	r.changed()
+}
+
+// Seek moves playback to offset. Entries between the old and new position are
+// skipped when seeking forward and emitted again when seeking backward.
+func (r *Replayer) Seek(offset time.Duration) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if offset < 0 {
+		offset = 0
+	}
+	pos := 0
+	for pos < len(r.items) && r.items[pos].offset < offset {
+		pos++
+	}
+	r.pos = pos
+	r.cursor = offset
+	r.resumedAt = time.Now()
+	r.changed()
+}
+
+func (r *Replayer) Status() replayStatus {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	var duration time.Duration
+	if len(r.items) > 0 {
+		duration = r.items[len(r.items)-1].offset
+	}
+	position := r.position()
+	if position > duration {
+		position = duration
+	}
+	return replayStatus{
+		Source:   r.source,
+		Speed:    r.speed,
+		Paused:   r.paused,
+		Done:     r.pos >= len(r.items),
+		Index:    r.pos,
+		Total:    len(r.items),
+		Position: position.String(),
+		Duration: duration.String(),
+	}
+}
+
+func serveReplayStatus(replayer *Replayer) http.HandlerFunc {
+	return func(w http.ResponseWriter, _ *http.Request) {
+		writeReplayStatus(w, replayer)
+	}
+}
+
+func serveReplayControl(replayer *Replayer, action func(*Replayer)) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodPost {
+			http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+			return
+		}
+		action(replayer)
+		writeReplayStatus(w, replayer)
+	}
+}
+
+func serveReplaySeek(replayer *Replayer) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodPost {
+			http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+			return
+		}
+		offset, err := time.ParseDuration(r.URL.Query().Get("offset"))
+		if err != nil {
+			http.Error(w, "offset must be a duration such as 90s or 5m", http.StatusBadRequest)
+			return
+		}
+		replayer.Seek(offset)
+		writeReplayStatus(w, replayer)
+	}
+}
+
+// validSpeed rejects zero, negative, NaN and infinite speeds, which would
+// stall the replay or release everything at once.
+func validSpeed(speed float64) bool {
+	return speed > 0 && !math.IsInf(speed, 0) && !math.IsNaN(speed)
+}
+
+func serveReplaySpeed(replayer *Replayer) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodPost {
+			http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+			return
+		}
+		speed, err := strconv.ParseFloat(r.URL.Query().Get("value"), 64)
+		if err != nil || !validSpeed(speed) {
+			http.Error(w, "value must be a positive number", http.StatusBadRequest)
+			return
+		}
+		replayer.SetSpeed(speed)
+		writeReplayStatus(w, replayer)
+	}
+}
+
+func writeReplayStatus(w http.ResponseWriter, replayer *Replayer) {
+	w.Header().Set("Content-Type", "application/json")
+	_ = json.NewEncoder(w).Encode(replayer.Status())
+}
@@ -0,0 +1,28 @@
+package main
+
+import (
+	"errors"
+
+	"github.com/klauspost/compress/snappy"
+)
+
+// snappyMaxExpansion bounds how much a snappy block can grow: the best a
+// standard block does is 64 bytes from a 3-byte copy. A declared length
+// beyond it cannot be honest, so it is refused before anything is allocated.
+const snappyMaxExpansion = 22
+
+var errSnappyCorrupt = errors.New("snappy: corrupt input")
+
+// decodeSnappy decodes a snappy block, the framing-less format Loki and
+// Prometheus clients use for protobuf push bodies.
+func decodeSnappy(src []byte) ([]byte, error) {
+	length, err := snappy.DecodedLen(src)
+	if err != nil || length > maxIngestBodySize || length > len(src)*snappyMaxExpansion {
+		return nil, errSnappyCorrupt
+	}
+	dst, err := snappy.DecodeStrict(nil, src)
+	if err != nil {
+		return nil, errSnappyCorrupt
+	}
+	return dst, nil
+}
@@ -0,0 +1,145 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// splunkChannelFields make the event source the channel when the event names
+// none itself.
+var splunkChannelFields = []string{"source", "sourcetype"}
+
+type splunkEvent struct {
+	Time       interface{}            `json:"time"`
+	Host       string                 `json:"host"`
+	Source     string                 `json:"source"`
+	SourceType string                 `json:"sourcetype"`
+	Index      string                 `json:"index"`
+	Event      json.RawMessage        `json:"event"`
+	Fields     map[string]interface{} `json:"fields"`
+}
+
+// serveSplunkEvent implements the Splunk HTTP Event Collector's event
+// endpoint. The body holds one or more JSON events back to back; any token
+// is accepted. Nothing is ingested unless every event is valid, so a client
+// retrying a rejected request does not store events twice.
+func serveSplunkEvent(pipeline *Pipeline) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodPost {
+			http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+			return
+		}
+		body, err := readIngestBody(w, r)
+		if err != nil {
+			writeSplunkStatus(w, http.StatusBadRequest, 6, err.Error())
+			return
+		}
+		decoder := json.NewDecoder(bytes.NewReader(body))
+		var entries []LogEntry
+		for {
+			var event splunkEvent
+			err := decoder.Decode(&event)
+			if errors.Is(err, io.EOF) {
+				break
+			}
+			if err != nil {
+				writeSplunkStatus(w, http.StatusBadRequest, 6, fmt.Sprintf("Invalid data format: %v", err))
+				return
+			}
+			if len(event.Event) == 0 {
+				writeSplunkStatus(w, http.StatusBadRequest, 12, "Event field is required")
+				return
+			}
+			entries = append(entries, entryFromSplunk(event))
+		}
+		for _, entry := range entries {
+			pipeline.Ingest(entry)
+		}
+		writeSplunkStatus(w, http.StatusOK, 0, "Success")
+	}
+}
+
+// serveSplunkRaw implements the raw endpoint: one event per line, with host,
+// source and sourcetype taken from the query string.
+func serveSplunkRaw(pipeline *Pipeline) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodPost {
+			http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+			return
+		}
+		body, err := readIngestBody(w, r)
+		if err != nil {
+			writeSplunkStatus(w, http.StatusBadRequest, 6, err.Error())
+			return
+		}
+		meta := map[string]interface{}{}
+		for _, key := range []string{"host", "source", "sourcetype", "index"} {
+			if value := r.URL.Query().Get(key); value != "" {
+				meta[key] = value
+			}
+		}
+		for _, line := range strings.Split(string(body), "\n") {
+			if strings.TrimSpace(line) == "" {
+				continue
+			}
+			pipeline.Ingest(entryFromPushedLine(strings.TrimRight(line, "\r"), meta, time.Time{}, splunkChannelFields))
+		}
+		writeSplunkStatus(w, http.StatusOK, 0, "Success")
+	}
+}
+
+func serveSplunkHealth(w http.ResponseWriter, _ *http.Request) {
+	writeSplunkStatus(w, http.StatusOK, 17, "HEC is healthy")
+}
+
+// entryFromSplunk parses a string event like a line from stdin and an object
+// event like a JSON line. The envelope's host, source, sourcetype, index and
+// indexed fields are added as fields, and its time is used when the event
+// has none of its own.
+func entryFromSplunk(event splunkEvent) LogEntry {
+	line := string(event.Event)
+	var text string
+	if err := json.Unmarshal(event.Event, &text); err == nil {
+		line = strings.TrimRight(text, "\r\n")
+	}
+	meta := make(map[string]interface{}, len(event.Fields)+4)
+	for key, value := range event.Fields {
+		meta[key] = value
+	}
+	for key, value := range map[string]string{"host": event.Host, "source": event.Source, "sourcetype": event.SourceType, "index": event.Index} {
+		if value != "" {
+			meta[key] = value
+		}
+	}
+	return entryFromPushedLine(line, meta, splunkTime(event.Time), splunkChannelFields)
+}
+
+// splunkTime reads HEC's epoch seconds, sent as a number or a string.
+func splunkTime(value interface{}) time.Time {
+	var seconds float64
+	switch v := value.(type) {
+	case float64:
+		seconds = v
+	case string:
+		parsed, err := strconv.ParseFloat(v, 64)
+		if err != nil {
+			return time.Time{}
+		}
+		seconds = parsed
+	default:
+		return time.Time{}
+	}
+	t, _ := timeFromNumber(seconds)
+	return t
+}
+
+func writeSplunkStatus(w http.ResponseWriter, status, code int, text string) {
+	writeJSON(w, status, map[string]interface{}{"text": text, "code": code})
+}
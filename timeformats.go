@@ -0,0 +1,96 @@
+package main
+
+import (
+	"strings"
+	"time"
+)
+
+// timeLayoutCatalog is tried in order after any preset or --time-layout
+// layouts. Layouts without fractional seconds still accept them, with either
+// a period or a comma as the separator.
+var timeLayoutCatalog = []string{
+	time.RFC3339Nano,
+	time.RFC3339,
+	"2006-01-02T15:04:05Z0700",
+	"2006-01-02T15:04:05",
+	"2006-01-02 15:04:05Z07:00",
+	"2006-01-02 15:04:05 Z07:00",
+	"2006-01-02 15:04:05Z0700",
+	"2006-01-02 15:04:05 -0700",
+	"2006-01-02 15:04:05 MST",
+	"2006-01-02 15:04:05",
+	"2006/01/02 15:04:05",
+	"2006/01/02T15:04:05",
+	"02/Jan/2006:15:04:05 -0700",
+	time.RFC1123Z,
+	time.RFC1123,
+	time.RFC850,
+	time.RFC822Z,
+	time.RFC822,
+	time.RubyDate,
+	time.UnixDate,
+	time.ANSIC,
+	"Jan _2 15:04:05 2006",
+	"Jan _2 2006 15:04:05",
+	time.Stamp,
+	"20060102T150405Z0700",
+	"20060102 15:04:05",
+	"060102 15:04:05",
+	"2006-01-02",
+}
+
+// completeYear fills in the year for layouts such as syslog's "Jan _2
+// 15:04:05" that omit it, picking the most recent year that does not put the
+// timestamp more than a day in the future.
+func completeYear(t time.Time) time.Time {
+	if t.Year() != 0 {
+		return t
+	}
+	now := time.Now().In(t.Location())
+	withYear := t.AddDate(now.Year(), 0, 0)
+	if withYear.After(now.Add(24 * time.Hour)) {
+		withYear = withYear.AddDate(-1, 0, 0)
+	}
+	return withYear
+}
+
+// maxLeadingTimeTokens bounds how many space-separated words a leading
+// timestamp may span; RFC1123 with a zone is the longest at six.
+const maxLeadingTimeTokens = 6
+
+// extractLeadingTime looks for a timestamp at the start of a plain-text line,
+// optionally wrapped in brackets, preferring the longest match.
+func extractLeadingTime(line string) (time.Time, bool) {
+	tokens := strings.Fields(line)
+	if len(tokens) == 0 {
+		return time.Time{}, false
+	}
+	first := tokens[0]
+	if len(first) == 0 || !(isDigit(first[0]) || first[0] == '[' || isLetter(first[0])) {
+		return time.Time{}, false
+	}
+	limit := maxLeadingTimeTokens
+	if len(tokens) < limit {
+		limit = len(tokens)
+	}
+	for n := limit; n >= 1; n-- {
+		candidate := strings.Join(tokens[:n], " ")
+		candidate = strings.TrimPrefix(candidate, "[")
+		candidate = strings.TrimRight(candidate, "]:,")
+		if candidate == "" {
+			continue
+		}
+		if t, ok := parseTimeString(candidate); ok {
+			return t, true
+		}
+	}
+	return time.Time{}, false
+}
+
+func isDigit(char byte) bool {
+	return char >= '0' && char <= '9'
+}
+
+func isLetter(char byte) bool {
+	return (char >= 'A' && char <= 'Z') || (char >= 'a' && char <= 'z')
+}
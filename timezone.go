@@ -0,0 +1,33 @@
+package main
+
+import (
+	"strings"
+	"time"
+	// Embed the zone database so IANA names work on hosts without one.
+	_ "time/tzdata"
+)
+
+// displayTimeLayout renders entry times in the display zone. The offset keeps
+// the string unambiguous for API clients when --tz differs from their zone.
+const displayTimeLayout = "2006-01-02 15:04:05.000 -07:00"
+
+// loadTimeZone accepts UTC, Local or an IANA zone name such as Europe/Berlin.
+func loadTimeZone(name string) (*time.Location, error) {
+	switch strings.ToLower(strings.TrimSpace(name)) {
+	case "", "local":
+		return time.Local, nil
+	case "utc", "z":
+		return time.UTC, nil
+	}
+	return time.LoadLocation(strings.TrimSpace(name))
+}
+
+// displayZoneName returns the IANA name of the display zone for the UI, or ""
+// when it is the server's local zone and the browser should use its own.
+func displayZoneName() string {
+	location := currentProfile().displayLocation
+	if location == time.Local {
+		return ""
+	}
+	return location.String()
+}
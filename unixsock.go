@@ -0,0 +1,119 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"log"
+	"net"
+	"os"
+	"strings"
+	"sync/atomic"
+	"time"
+)
+
+// listenUnix accepts newline-delimited logs on a Unix stream socket. Each
+// connection is read like stdin and tagged as its own source.
+func listenUnix(path string, pipeline *Pipeline) error {
+	if err := removeStaleSocket(path); err != nil {
+		return err
+	}
+	listener, err := net.Listen("unix", path)
+	if err != nil {
+		return err
+	}
+	var connections atomic.Int64
+	go acceptConnections(listener, "unix", func(conn net.Conn) {
+		source := fmt.Sprintf("unix:%s#%d", path, connections.Add(1))
+		if err := readLines(pipeline.WithSource(source), conn); err != nil {
+			log.Printf("%s: %v", source, err)
+		}
+	})
+	return nil
+}
+
+// listenUnixgram accepts logs on a Unix datagram socket. A datagram may hold
+// several lines; senders that bound an address of their own are told apart
+// by it.
+func listenUnixgram(path string, pipeline *Pipeline) error {
+	if err := removeStaleSocket(path); err != nil {
+		return err
+	}
+	conn, err := net.ListenPacket("unixgram", path)
+	if err != nil {
+		return err
+	}
+	go func() {
+		buf := make([]byte, gelfMaxDatagram)
+		for {
+			n, addr, err := conn.ReadFrom(buf)
+			if err != nil {
+				if errors.Is(err, net.ErrClosed) {
+					return
+				}
+				log.Printf("unixgram %s: %v", path, err)
+				continue
+			}
+			source := "unixgram:" + path
+			if addr != nil && addr.String() != "" {
+				source = "unixgram:" + addr.String()
+			}
+			tagged := pipeline.WithSource(source)
+			for _, line := range strings.Split(strings.TrimRight(string(buf[:n]), "\n"), "\n") {
+				tagged.Ingest(entryFromLine(line))
+			}
+		}
+	}()
+	return nil
+}
+
+// removeStaleSocket deletes a socket file left behind by an earlier run, but
+// refuses to touch other files or a socket that something still listens on.
+func removeStaleSocket(path string) error {
+	info, err := os.Lstat(path)
+	if errors.Is(err, os.ErrNotExist) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	if info.Mode()&os.ModeSocket == 0 {
+		return fmt.Errorf("%s exists and is not a socket", path)
+	}
+	for _, network := range []string{"unix", "unixgram"} {
+		if conn, err := net.DialTimeout(network, path, time.Second); err == nil {
+			conn.Close()
+			return fmt.Errorf("%s is in use", path)
+		}
+	}
+	return os.Remove(path)
+}
+
+// readFIFO reads a named pipe, creating it if needed. Opening blocks until a
+// writer arrives and reading ends when the last writer closes, so the pipe
+// is reopened in a loop and stays available to later writers.
+func readFIFO(path string, pipeline *Pipeline) error {
+	if info, err := os.Stat(path); errors.Is(err, os.ErrNotExist) {
+		if err := makeFIFO(path); err != nil {
+			return err
+		}
+	} else if err != nil {
+		return err
+	} else if info.Mode()&os.ModeNamedPipe == 0 {
+		return fmt.Errorf("%s exists and is not a named pipe", path)
+	}
+	tagged := pipeline.WithSource("fifo:" + path)
+	go func() {
+		for {
+			file, err := os.Open(path)
+			if err != nil {
+				log.Printf("fifo %s: %v", path, err)
+				return
+			}
+			if err := readLines(tagged, file); err != nil {
+				log.Printf("fifo %s: %v", path, err)
+			}
+			file.Close()
+		}
+	}()
+	return nil
+}
@@ -3,8 +3,10 @@ const levelRank = {
   trace: 10,
   debug: 20,
   info: 30,
+  notice: 35,
   warn: 40,
   error: 50,
+  critical: 55,
   fatal: 60,
   plain: 0,
   unknown: 0,
@@ -15,16 +17,20 @@ const levelLabels = {
   trace: "Trace",
   debug: "Debug",
   info: "Info",
+  notice: "Notice",
   warn: "Warn",
   error: "Error",
+  critical: "Critical",
   fatal: "Fatal",
 };
 
 const CHANNEL_ALL = "__all__";
 const CHANNEL_UNSPECIFIED = "__unspecified__";
+const SOURCE_ALL = "__all__";
 
 const state = {
   logs: [],
+  timeZone: "",
   filteredCount: 0,
   selectedId: null,
   selectedIds: new Set(),
@@ -61,6 +67,8 @@ const state = {
   channelOptions: new Set(),
   hasUnspecifiedChannel: false,
   selectedChannels: new Set(),
+  sourceOptions: new Set(),
+  selectedSources: new Set(),
   groupState: {
     lastJsonTimestampMs: null,
     hasGroup: false,
@@ -128,6 +136,8 @@ function cacheDom() {
   dom.levelMinLabel = document.getElementById("levelMinLabel");
   dom.levelMaxLabel = document.getElementById("levelMaxLabel");
   dom.channelButtons = document.getElementById("channelButtons");
+  dom.sourceControl = document.getElementById("sourceControl");
+  dom.sourceButtons = document.getElementById("sourceButtons");
   dom.filterInput = document.getElementById("filterInput");
   dom.mapInput = document.getElementById("mapInput");
   dom.mapInputTag = document.getElementById("mapInputTag");
@@ -165,6 +175,7 @@ function cacheDom() {
   dom.detailTime = document.getElementById("detailTime");
   dom.detailIngested = document.getElementById("detailIngested");
   dom.detailChannel = document.getElementById("detailChannel");
+  dom.detailSource = document.getElementById("detailSource");
   dom.detailPid = document.getElementById("detailPid");
   dom.detailHostname = document.getElementById("detailHostname");
   dom.detailMessage = document.getElementById("detailMessage");
@@ -227,6 +238,27 @@ function bindEvents() {
     persistPreferences();
   });
 
+  dom.sourceButtons.addEventListener("click", (event) => {
+    const button = event.target.closest("button");
+    if (!button || !dom.sourceButtons.contains(button)) {
+      return;
+    }
+    const value = button.dataset.source || "";
+    if (!value) {
+      return;
+    }
+    if (value === SOURCE_ALL) {
+      state.selectedSources.clear();
+    } else if (state.selectedSources.has(value)) {
+      state.selectedSources.delete(value);
+    } else {
+      state.selectedSources.add(value);
+    }
+    renderSourceOptions();
+    renderAll();
+    persistPreferences();
+  });
+
   dom.filterInput.addEventListener("keydown", (event) => {
     if (event.key === "Enter") {
       event.preventDefault();
@@ -522,6 +554,9 @@ function loadStoredPreferences() {
   if (Array.isArray(prefs.selectedChannels)) {
     state.selectedChannels = new Set(prefs.selectedChannels);
   }
+  if (Array.isArray(prefs.selectedSources)) {
+    state.selectedSources = new Set(prefs.selectedSources);
+  }
   
   // Apply CSS classes based on loaded preferences
   if (dom.logList) {
@@ -554,6 +589,7 @@ function persistPreferences() {
       maxLevel: state.maxLevel,
       mapRaw: state.mapRaw,
       selectedChannels: Array.from(state.selectedChannels),
+      selectedSources: Array.from(state.selectedSources),
     };
     localStorage.setItem(prefsStorageKey, JSON.stringify(prefs));
   } catch (err) {
@@ -597,6 +633,12 @@ function loadConfig() {
       if (config && Number.isFinite(config.maxEntries)) {
         state.clientMax = config.maxEntries;
       }
+      if (config && typeof config.timeZone === "string") {
+        state.timeZone = config.timeZone;
+      }
+      if (config && Array.isArray(config.levels)) {
+        applyConfigLevels(config.levels);
+      }
       if (config && Array.isArray(config.filters)) {
         applyConfigFilters(config.filters);
       }
@@ -604,6 +646,39 @@ function loadConfig() {
     .catch(() => {});
 }
 
+function applyConfigLevels(levels) {
+  const names = levels
+    .map((level) => (level && typeof level.name === "string" ? level.name : ""))
+    .filter(Boolean);
+  if (!names.length || names.join(",") === levelOrder.join(",")) {
+    return;
+  }
+  for (const level of levels) {
+    if (level && typeof level.name === "string" && Number.isFinite(level.num)) {
+      levelRank[level.name] = level.num;
+    }
+  }
+  levelOrder.splice(0, levelOrder.length, ...names);
+  const maxIndex = levelOrder.length - 1;
+  if (!dom.levelMinRange || !dom.levelMaxRange) {
+    return;
+  }
+  dom.levelMinRange.max = String(maxIndex);
+  dom.levelMaxRange.max = String(maxIndex);
+  let minIndex = levelOrder.indexOf(state.minLevel);
+  let maxLevelIndex = levelOrder.indexOf(state.maxLevel);
+  if (minIndex < 0 || maxLevelIndex < 0) {
+    minIndex = 0;
+    maxLevelIndex = maxIndex;
+  }
+  dom.levelMinRange.value = String(minIndex);
+  dom.levelMaxRange.value = String(maxLevelIndex);
+  updateLevelRangeUI(minIndex, maxLevelIndex);
+  if (updateLevelRangeState(minIndex, maxLevelIndex)) {
+    renderAll();
+  }
+}
+
 function applyConfigFilters(rawFilters) {
   if (!Array.isArray(rawFilters) || rawFilters.length === 0) {
     return;
@@ -784,6 +859,7 @@ function handleEntry(entry) {
   state.logs.push(entry);
   recordLatency(entry);
   maybeAddChannelOption(entry);
+  maybeAddSourceOption(entry);
   if (state.debugPerf && state.renderInProgress && state.logs.length % 1000 === 0) {
     console.log(
       `[perf] incoming logs while rendering: total=${state.logs.length} needsRender=${state.needsRender}`,
@@ -918,6 +994,7 @@ function renderAll() {
   state.filteredCount = 0;
   dom.logList.innerHTML = "";
   rebuildChannelOptions();
+  rebuildSourceOptions();
   state.filterKey = filterKey();
 
   const renderStart = state.debugPerf ? performance.now() : 0;
@@ -1094,6 +1171,13 @@ function formatGroupLabel(entry) {
   if (!Number.isFinite(parsed)) {
     return raw || "No timestamp";
   }
+  if (state.timeZone) {
+    try {
+      return new Date(parsed).toLocaleString(undefined, { timeZone: state.timeZone });
+    } catch (err) {
+      // Unknown zone names fall back to the browser's zone.
+    }
+  }
   return new Date(parsed).toLocaleString();
 }
 
@@ -1110,7 +1194,7 @@ function parseLogTimestamp(raw) {
     return null;
   }
   const match =
-    /^(\d{4})-(\d{2})-(\d{2})[ T](\d{2}):(\d{2}):(\d{2})(?:\.(\d{1,3}))?$/.exec(raw);
+    /^(\d{4})-(\d{2})-(\d{2})[ T](\d{2}):(\d{2}):(\d{2})(?:\.(\d{1,3}))?(?: ?(Z|[+-]\d{2}:?\d{2}))?$/.exec(raw);
   if (match) {
     const year = Number(match[1]);
     const month = Number(match[2]) - 1;
@@ -1119,17 +1203,31 @@ function parseLogTimestamp(raw) {
     const minute = Number(match[5]);
     const second = Number(match[6]);
     const ms = Number((match[7] || "0").padEnd(3, "0"));
+    if (match[8]) {
+      const utc = Date.UTC(year, month, day, hour, minute, second, ms);
+      return utc - parseOffsetMinutes(match[8]) * 60000;
+    }
     return new Date(year, month, day, hour, minute, second, ms).getTime();
   }
   const parsed = Date.parse(raw);
   return Number.isFinite(parsed) ? parsed : null;
 }
 
+function parseOffsetMinutes(offset) {
+  if (offset === "Z") {
+    return 0;
+  }
+  const digits = offset.slice(1).replace(":", "");
+  const minutes = Number(digits.slice(0, 2)) * 60 + Number(digits.slice(2));
+  return offset[0] === "-" ? -minutes : minutes;
+}
+
 function filterKey() {
   return [
     state.minLevel,
     state.maxLevel,
     channelKey(),
+    sourceKey(),
     state.showPlain,
     state.showChannel,
     state.mapRaw,
@@ -1145,6 +1243,13 @@ function channelKey() {
   return Array.from(state.selectedChannels).sort().join(",");
 }
 
+function sourceKey() {
+  if (!state.selectedSources.size) {
+    return "all";
+  }
+  return Array.from(state.selectedSources).sort().join(",");
+}
+
 function initLevelRange() {
   if (!dom.levelMinRange || !dom.levelMaxRange) {
     return;
@@ -1324,6 +1429,10 @@ function passesFilters(entry) {
     }
   }
 
+  if (state.selectedSources.size && !state.selectedSources.has(entry.source || "")) {
+    return false;
+  }
+
   if (!isPlain && state.minLevel !== "all") {
     const minRank = levelRank[state.minLevel] || 0;
     const entryRank = levelRank[level] || 0;
@@ -2057,6 +2166,9 @@ function buildFilterScope(entry) {
   assignIfMissing(scope, "message", entry.msg);
   assignIfMissing(scope, "raw", entry.raw);
   assignIfMissing(scope, "parseError", entry.parseError);
+  if (entry.source) {
+    assignIfMissing(scope, "source", entry.source);
+  }
   const channelValue = getChannelValue(entry);
   if (channelValue !== undefined && channelValue !== null) {
     assignIfMissing(scope, "channel", channelValue);
@@ -2108,12 +2220,17 @@ function buildRow(entry) {
   const baseColumns = state.showChannel ? "30px 60px" : "30px";
   row.style.gridTemplateColumns = `${baseColumns} ${"minmax(0, 1fr) ".repeat(mapCellCount).trim()}`;
   const messageCells = mappedValues.length ? mappedValues : [""];
-  const msgCells = messageCells.map((value) => {
+  const mapPaths = getMapPaths();
+  const msgCells = messageCells.map((value, index) => {
     const msgCell = document.createElement("div");
     msgCell.className = "cell message-cell";
     const message = document.createElement("div");
     message.className = "message";
-    message.textContent = sanitizeMessage(value);
+    if (entry.msgSpans && isMessagePath(mapPaths[index])) {
+      renderMessageSpans(message, entry.msgSpans);
+    } else {
+      message.textContent = sanitizeMessage(value);
+    }
     msgCell.appendChild(message);
     return msgCell;
   });
@@ -2433,7 +2550,59 @@ function buildChannelButton(label, value, isActive) {
   return button;
 }
 
+function rebuildSourceOptions() {
+  state.sourceOptions = new Set();
+  for (const entry of state.logs) {
+    if (entry.source) {
+      state.sourceOptions.add(entry.source);
+    }
+  }
+  renderSourceOptions();
+}
+
+function maybeAddSourceOption(entry) {
+  if (entry.source && !state.sourceOptions.has(entry.source)) {
+    state.sourceOptions.add(entry.source);
+    renderSourceOptions();
+  }
+}
+
+// renderSourceOptions lists the inputs entries came from. The control stays
+// hidden while there is only one, as with plain stdin.
+function renderSourceOptions() {
+  if (!dom.sourceButtons) {
+    return;
+  }
+  const options = new Set(state.sourceOptions);
+  for (const selected of state.selectedSources) {
+    options.add(selected);
+  }
+  const sorted = Array.from(options);
+  sorted.sort((a, b) => a.localeCompare(b, undefined, { sensitivity: "base" }));
+
+  dom.sourceControl.hidden = sorted.length < 2;
+  dom.sourceButtons.innerHTML = "";
+  dom.sourceButtons.appendChild(
+    buildSourceButton("All", SOURCE_ALL, state.selectedSources.size === 0),
+  );
+  for (const option of sorted) {
+    dom.sourceButtons.appendChild(
+      buildSourceButton(option, option, state.selectedSources.has(option)),
+    );
+  }
+}
+
+function buildSourceButton(label, value, isActive) {
+  const button = buildChannelButton(label, value, isActive);
+  delete button.dataset.channel;
+  button.dataset.source = value;
+  return button;
+}
+
 function getChannelValue(entry) {
+  if (entry.channel !== undefined && entry.channel !== null) {
+    return entry.channel;
+  }
   let value = getFieldValue(entry, "channel");
   if (value === undefined) {
     value = getFieldValue(entry, "chanel");
@@ -2690,10 +2859,16 @@ function selectEntry(id) {
   dom.detailTime.textContent = entry.time || "-";
   dom.detailIngested.textContent = entry.ingested || "-";
   dom.detailChannel.textContent = formatChannel(getChannelValue(entry));
+  dom.detailSource.textContent = entry.source || "-";
   dom.detailPid.textContent = formatDetailValue(getFieldValue(entry, "pid"));
   dom.detailHostname.textContent = formatDetailValue(getFieldValue(entry, "hostname"));
   const mappedValues = formatMappedValues(entry).filter((value) => value !== "");
-  dom.detailMessage.textContent = mappedValues.join(" | ") || entry.msg || entry.raw || "-";
+  const mapPaths = getMapPaths();
+  if (entry.msgSpans && mapPaths.length === 1 && isMessagePath(mapPaths[0])) {
+    renderMessageSpans(dom.detailMessage, entry.msgSpans);
+  } else {
+    dom.detailMessage.textContent = mappedValues.join(" | ") || entry.msg || entry.raw || "-";
+  }
   dom.detailParseError.textContent = entry.parseError || "-";
   dom.detailRaw.textContent = entry.raw || "";
   renderDetailFields(entry);
@@ -2717,6 +2892,7 @@ function clearDetailPanel() {
   dom.detailTime.textContent = "-";
   dom.detailIngested.textContent = "-";
   dom.detailChannel.textContent = "-";
+  dom.detailSource.textContent = "-";
   dom.detailPid.textContent = "-";
   dom.detailHostname.textContent = "-";
   dom.detailMessage.textContent = "-";
@@ -2732,10 +2908,50 @@ function sanitizeMessage(value) {
   return String(value).replace(/[\r\n]+/g, " ");
 }
 
+function getMapPaths() {
+  return state.mapPaths && state.mapPaths.length ? state.mapPaths : [["msg"]];
+}
+
 function formatMappedValues(entry) {
   const scope = buildFilterScope(entry);
-  const paths = state.mapPaths && state.mapPaths.length ? state.mapPaths : [["msg"]];
-  return paths.map((path) => formatMapValue(getValueAtPath(scope, path)));
+  return getMapPaths().map((path) => formatMapValue(getValueAtPath(scope, path)));
+}
+
+function isMessagePath(path) {
+  return Boolean(path) && path.length === 1 && (path[0] === "msg" || path[0] === "message");
+}
+
+// Render the color spans the server keeps for messages with ANSI codes
+// (--ansi spans). Palette names map to theme variables.
+function renderMessageSpans(target, spans) {
+  target.textContent = "";
+  spans.forEach((span) => {
+    const node = document.createElement("span");
+    node.textContent = sanitizeMessage(span.text);
+    if (span.fg) {
+      node.style.color = ansiColor(span.fg);
+    }
+    if (span.bg) {
+      node.style.backgroundColor = ansiColor(span.bg);
+    }
+    if (span.bold) {
+      node.style.fontWeight = "700";
+    }
+    if (span.dim) {
+      node.style.opacity = "0.7";
+    }
+    if (span.italic) {
+      node.style.fontStyle = "italic";
+    }
+    if (span.underline) {
+      node.style.textDecoration = "underline";
+    }
+    target.appendChild(node);
+  });
+}
+
+function ansiColor(value) {
+  return value.startsWith("#") ? value : `var(--ansi-${value})`;
 }
 
 function formatMapValue(value) {
@@ -2785,6 +3001,9 @@ function copyText(text, button, label) {
 
 function normalizeLevel(level) {
   const raw = String(level || "unknown").toLowerCase();
+  if (levelOrder.includes(raw)) {
+    return raw;
+  }
   switch (raw) {
     case "warning":
       return "warn";